@@ -16,14 +16,22 @@ type arityFn func() int
 type callFn func(args []LoxValue, i *Interpreter) (LoxValue, error)
 
 type NativeFunction struct {
+	// name is only used for stack traces, and is filled in when the native is
+	// defined in an environment
+	name  string
 	arity arityFn
 	call  callFn
 }
 
 func NewNativeFunction(arity arityFn, call callFn) *NativeFunction {
 	return &NativeFunction{
-		arity,
-		call}
+		arity: arity,
+		call:  call}
+}
+
+func defineNative(env *Environment, name string, fn *NativeFunction) {
+	fn.name = name
+	env.Define(name, fn)
 }
 
 func (f *NativeFunction) Arity() int {
@@ -38,39 +46,75 @@ func (f *NativeFunction) String() string {
 	return "<native function>"
 }
 
+// NativeError is returned by native functions, which have no token of their
+// own to report. The interpreter converts it into a RuntimeError at the call
+// site.
+type NativeError struct {
+	message string
+}
+
+func (e *NativeError) Error() string {
+	return e.message
+}
+
+func NewNativeError(message string) *NativeError {
+	return &NativeError{message}
+}
+
 type LoxFunction struct {
-	declaration   FunctionStmt
+	name          string
+	params        []token.Token
+	body          []Stmt
 	closure       *Environment
 	isInitializer bool
+	// the name of the class a method was declared in, for stack traces
+	class string
+	// functions always run against the globals of the module that defined
+	// them, even when called from another module
+	module *LoxModule
+}
+
+func NewLoxFunction(declaration FunctionStmt, closure *Environment, isInitializer bool, module *LoxModule) *LoxFunction {
+	return &LoxFunction{declaration.name.Lexeme, declaration.params, declaration.body, closure, isInitializer, "", module}
 }
 
-func NewLoxFunction(declaration FunctionStmt, closure *Environment, isInitializer bool) LoxFunction {
-	return LoxFunction{declaration, closure, isInitializer}
+// Anonymous functions have no name token, so they are always printed as
+// "<fn anonymous>"
+func NewLoxLambda(expr FunctionExpr, closure *Environment, module *LoxModule) *LoxFunction {
+	return &LoxFunction{"anonymous", expr.params, expr.body, closure, false, "", module}
 }
 
-func (f LoxFunction) Arity() int {
-	return len(f.declaration.params)
+func (f *LoxFunction) Arity() int {
+	return len(f.params)
 }
 
-func (f LoxFunction) bind(ctx *LoxInstance) LoxFunction {
+// bind returns a new function, so a method bound to an instance is a
+// different value each time it is looked up
+func (f *LoxFunction) bind(ctx *LoxInstance) *LoxFunction {
 	env := NewEnvironment(f.closure)
 	env.Define("this", ctx)
-	return NewLoxFunction(f.declaration, env, f.isInitializer)
+	bound := *f
+	bound.closure = env
+	return &bound
 }
 
-func (f LoxFunction) Call(args []LoxValue, i *Interpreter) (LoxValue, error) {
+func (f *LoxFunction) Call(args []LoxValue, i *Interpreter) (LoxValue, error) {
 	funcEnv := NewEnvironment(f.closure)
 
-	for i := range f.declaration.params {
-		funcEnv.Define(f.declaration.params[i].Lexeme, args[i])
+	for i := range f.params {
+		funcEnv.Define(f.params[i].Lexeme, args[i])
 	}
 
 	var err error = nil
 	prevEnv := i.currentEnv
 	i.currentEnv = funcEnv
-	defer func() { i.currentEnv = prevEnv }()
-	for _, stmt := range f.declaration.body {
-		err = stmt.(EvaluableStmt).Evaluate(i)
+	prevModule := i.enterModule(f.module)
+	defer func() {
+		i.currentEnv = prevEnv
+		i.enterModule(prevModule)
+	}()
+	for _, stmt := range f.body {
+		err = i.execute(stmt)
 		if err != nil {
 			switch err := err.(type) {
 			case *ReturnException:
@@ -79,7 +123,7 @@ func (f LoxFunction) Call(args []LoxValue, i *Interpreter) (LoxValue, error) {
 				}
 				return err.value, nil
 			default:
-				break
+				return nil, err
 			}
 		}
 	}
@@ -88,17 +132,39 @@ func (f LoxFunction) Call(args []LoxValue, i *Interpreter) (LoxValue, error) {
 	}
 	return nil, err
 }
-func (f LoxFunction) String() string {
-	return fmt.Sprintf("<fn %s>", f.declaration.name.Lexeme)
+func (f *LoxFunction) String() string {
+	return fmt.Sprintf("<fn %s>", f.name)
+}
+
+// Describes a call to fn from the given call site. Calling a class runs its
+// initializer, so it is reported as a call to init.
+func callFrame(fn Callable, site token.Token) errors.StackFrame {
+	frame := errors.StackFrame{Line: site.Line}
+	switch fn := fn.(type) {
+	case *LoxFunction:
+		frame.Function = fn.name
+		frame.Class = fn.class
+	case *LoxClass:
+		frame.Function = "init"
+		frame.Class = fn.name
+	case *NativeFunction:
+		frame.Function = fn.name
+		if frame.Function == "" {
+			frame.Function = "<native function>"
+		}
+	default:
+		frame.Function = "<unknown>"
+	}
+	return frame
 }
 
 type LoxClass struct {
 	name       string
 	superclass *LoxClass
-	methods    map[string]LoxFunction
+	methods    map[string]*LoxFunction
 }
 
-func NewLoxClass(name string, superclass *LoxClass, methods map[string]LoxFunction) *LoxClass {
+func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction) *LoxClass {
 	return &LoxClass{name, superclass, methods}
 }
 
@@ -110,7 +176,10 @@ func (c *LoxClass) Call(args []LoxValue, i *Interpreter) (LoxValue, error) {
 	instance := NewLoxInstance(c)
 	initializer := c.findMethod("init")
 	if initializer != nil {
-		initializer.bind(instance).Call(args, i)
+		_, err := initializer.bind(instance).Call(args, i)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return instance, nil
@@ -126,7 +195,7 @@ func (c *LoxClass) Arity() int {
 
 func (c *LoxClass) findMethod(name string) *LoxFunction {
 	if method, ok := c.methods[name]; ok {
-		return &method
+		return method
 	}
 
 	if c.superclass != nil {
@@ -0,0 +1,540 @@
+package ast
+
+import (
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+	"github.com/faideww/glox/src/vm"
+)
+
+type Compilable interface {
+	Compile(c *vm.Compiler) error
+}
+
+// Compile translates a resolved program into bytecode for the VM backend
+func Compile(statements []Stmt) (*vm.Function, error) {
+	c := vm.NewCompiler()
+	for _, statement := range statements {
+		err := statement.(Compilable).Compile(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.EmitOp(vm.OP_NIL, c.Position())
+	c.EmitOp(vm.OP_RETURN, c.Position())
+	return c.Script(), nil
+}
+
+// CompileExpression translates a single expression into a script that returns
+// its value, for use by the REPL
+func CompileExpression(expression Expr) (*vm.Function, error) {
+	c := vm.NewCompiler()
+	err := expression.(Compilable).Compile(c)
+	if err != nil {
+		return nil, err
+	}
+	c.EmitOp(vm.OP_RETURN, c.Position())
+	return c.Script(), nil
+}
+
+func (bs BlockStmt) Compile(c *vm.Compiler) error {
+	c.BeginScope()
+	for _, statement := range bs.statements {
+		err := statement.(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+	}
+	c.EndScope(c.Position())
+	return nil
+}
+
+func (bs BreakStmt) Compile(c *vm.Compiler) error {
+	return c.EmitBreak(bs.token.Position)
+}
+
+func (cs ClassStmt) Compile(c *vm.Compiler) error {
+	err := c.DeclareVariable(cs.name)
+	if err != nil {
+		return err
+	}
+	err = c.EmitNameOp(vm.OP_CLASS, cs.name)
+	if err != nil {
+		return err
+	}
+	err = c.DefineVariable(cs.name)
+	if err != nil {
+		return err
+	}
+
+	if cs.superclass != nil {
+		err = cs.superclass.Compile(c)
+		if err != nil {
+			return err
+		}
+
+		// the superclass stays on the stack as a local named "super" for the
+		// duration of the class body, so that methods can capture it
+		c.BeginScope()
+		err = c.DefineLocal("super", cs.superclass.name.Position)
+		if err != nil {
+			return err
+		}
+
+		err = c.GetVariable(cs.name)
+		if err != nil {
+			return err
+		}
+		c.EmitOp(vm.OP_INHERIT, cs.name.Position)
+	}
+
+	err = c.GetVariable(cs.name)
+	if err != nil {
+		return err
+	}
+
+	for _, method := range cs.methods {
+		var kind vm.FunctionKind = vm.FNKIND_METHOD
+		if method.name.Lexeme == "init" {
+			kind = vm.FNKIND_INITIALIZER
+		}
+		err = compileFunction(c, method.name.Lexeme, method.params, method.body, kind)
+		if err != nil {
+			return err
+		}
+		err = c.EmitNameOp(vm.OP_METHOD, method.name)
+		if err != nil {
+			return err
+		}
+	}
+	c.EmitOp(vm.OP_POP, c.Position())
+
+	if cs.superclass != nil {
+		c.EndScope(c.Position())
+	}
+
+	return nil
+}
+
+func (cs ContinueStmt) Compile(c *vm.Compiler) error {
+	return c.EmitContinue(cs.token.Position)
+}
+
+func (es ExpressionStmt) Compile(c *vm.Compiler) error {
+	err := es.expression.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(vm.OP_POP, c.Position())
+	return nil
+}
+
+func (fs ForStmt) Compile(c *vm.Compiler) error {
+	return fs.loop.(Compilable).Compile(c)
+}
+
+func (fs FunctionStmt) Compile(c *vm.Compiler) error {
+	err := c.DeclareVariable(fs.name)
+	if err != nil {
+		return err
+	}
+	c.MarkInitialized()
+
+	err = compileFunction(c, fs.name.Lexeme, fs.params, fs.body, vm.FNKIND_FUNCTION)
+	if err != nil {
+		return err
+	}
+
+	return c.DefineVariable(fs.name)
+}
+
+func compileFunction(c *vm.Compiler, name string, params []token.Token, body []Stmt, kind vm.FunctionKind) error {
+	c.BeginFunction(name, len(params), kind)
+	for _, param := range params {
+		err := c.DeclareVariable(param)
+		if err != nil {
+			return err
+		}
+		err = c.DefineVariable(param)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range body {
+		err := statement.(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.EndFunction(c.Position())
+}
+
+func (is IfStmt) Compile(c *vm.Compiler) error {
+	err := is.condition.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	thenJump := c.EmitJump(vm.OP_JUMP_IF_FALSE, c.Position())
+	c.EmitOp(vm.OP_POP, c.Position())
+	err = is.thenBranch.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	elseJump := c.EmitJump(vm.OP_JUMP, c.Position())
+	err = c.PatchJump(thenJump)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(vm.OP_POP, c.Position())
+
+	if is.elseBranch != nil {
+		err = is.elseBranch.(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.PatchJump(elseJump)
+}
+
+func (is ImportStmt) Compile(c *vm.Compiler) error {
+	return errors.NewAnalysisError(is.keyword, "Imports are not supported by the bytecode VM")
+}
+
+func (ps PrintStmt) Compile(c *vm.Compiler) error {
+	err := ps.expression.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(vm.OP_PRINT, c.Position())
+	return nil
+}
+
+func (rs ReturnStmt) Compile(c *vm.Compiler) error {
+	if rs.value == nil {
+		c.EmitReturn(rs.keyword.Position)
+		return nil
+	}
+
+	err := rs.value.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(vm.OP_RETURN, rs.keyword.Position)
+	return nil
+}
+
+func (ts ThrowStmt) Compile(c *vm.Compiler) error {
+	return errors.NewAnalysisError(ts.keyword, "Exceptions are not supported by the bytecode VM")
+}
+
+func (ts TryStmt) Compile(c *vm.Compiler) error {
+	return errors.NewAnalysisError(ts.keyword, "Exceptions are not supported by the bytecode VM")
+}
+
+func (vs VarStmt) Compile(c *vm.Compiler) error {
+	err := c.DeclareVariable(vs.name)
+	if err != nil {
+		return err
+	}
+
+	if vs.initializer == nil {
+		c.EmitOp(vm.OP_NIL, vs.name.Position)
+	} else {
+		err = vs.initializer.(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.DefineVariable(vs.name)
+}
+
+func (ws WhileStmt) Compile(c *vm.Compiler) error {
+	loopStart := c.LoopStart()
+	err := ws.condition.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	exitJump := c.EmitJump(vm.OP_JUMP_IF_FALSE, c.Position())
+	c.EmitOp(vm.OP_POP, c.Position())
+
+	// the increment is compiled before the body, which jumps back to it at
+	// the end of each iteration and on continue
+	if ws.increment != nil {
+		bodyJump := c.EmitJump(vm.OP_JUMP, c.Position())
+		incrementStart := c.LoopStart()
+		err = ws.increment.(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+		err = c.EmitLoop(loopStart, c.Position())
+		if err != nil {
+			return err
+		}
+		loopStart = incrementStart
+		err = c.PatchJump(bodyJump)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.BeginLoop(loopStart)
+	err = ws.body.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	err = c.EmitLoop(loopStart, c.Position())
+	if err != nil {
+		return err
+	}
+
+	err = c.PatchJump(exitJump)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(vm.OP_POP, c.Position())
+
+	// breaks have already popped the condition, so they land after the pop
+	return c.EndLoop()
+}
+
+func (a AssignmentExpr) Compile(c *vm.Compiler) error {
+	err := a.value.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	return c.SetVariable(a.name)
+}
+
+var binaryOps = map[token.TokenType]vm.OpCode{
+	token.BANG_EQUAL:    vm.OP_NOT_EQUAL,
+	token.EQUAL_EQUAL:   vm.OP_EQUAL,
+	token.GREATER:       vm.OP_GREATER,
+	token.GREATER_EQUAL: vm.OP_GREATER_EQUAL,
+	token.LESS:          vm.OP_LESS,
+	token.LESS_EQUAL:    vm.OP_LESS_EQUAL,
+	token.MINUS:         vm.OP_SUBTRACT,
+	token.PLUS:          vm.OP_ADD,
+	token.SLASH:         vm.OP_DIVIDE,
+	token.STAR:          vm.OP_MULTIPLY,
+}
+
+func (b BinaryExpr) Compile(c *vm.Compiler) error {
+	err := b.left.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	err = b.right.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	c.EmitOp(binaryOps[b.operator.TokenType], b.operator.Position)
+	return nil
+}
+
+func (ce CallExpr) Compile(c *vm.Compiler) error {
+	err := ce.callee.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	for _, arg := range ce.arguments {
+		err = arg.(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+	}
+	c.EmitCall(len(ce.arguments), ce.paren.Position)
+	return nil
+}
+
+func (f FunctionExpr) Compile(c *vm.Compiler) error {
+	return compileFunction(c, "anonymous", f.params, f.body, vm.FNKIND_FUNCTION)
+}
+
+func (g GetExpr) Compile(c *vm.Compiler) error {
+	err := g.object.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	return c.EmitNameOp(vm.OP_GET_PROPERTY, g.name)
+}
+
+func (g GroupingExpr) Compile(c *vm.Compiler) error {
+	return g.expression.(Compilable).Compile(c)
+}
+
+func (ie IndexExpr) Compile(c *vm.Compiler) error {
+	err := ie.object.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	err = ie.index.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(vm.OP_GET_INDEX, ie.bracket.Position)
+	return nil
+}
+
+func (is IndexSetExpr) Compile(c *vm.Compiler) error {
+	err := is.object.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	err = is.index.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	err = is.value.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(vm.OP_SET_INDEX, is.bracket.Position)
+	return nil
+}
+
+func (l ListExpr) Compile(c *vm.Compiler) error {
+	for _, element := range l.elements {
+		err := element.(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+	}
+	return c.EmitBuildList(len(l.elements), l.bracket.Position)
+}
+
+func (l LiteralExpr) Compile(c *vm.Compiler) error {
+	switch l.value {
+	case nil:
+		c.EmitOp(vm.OP_NIL, c.Position())
+	case true:
+		c.EmitOp(vm.OP_TRUE, c.Position())
+	case false:
+		c.EmitOp(vm.OP_FALSE, c.Position())
+	default:
+		return c.EmitConstant(l.value, c.Position())
+	}
+	return nil
+}
+
+func (l LogicalExpr) Compile(c *vm.Compiler) error {
+	err := l.left.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	// "and" skips the right operand when the left is falsey, "or" when it is
+	// truthy. Either way the left operand is the result if it is skipped.
+	var endJump int
+	if l.operator.TokenType == token.AND {
+		endJump = c.EmitJump(vm.OP_JUMP_IF_FALSE, l.operator.Position)
+	} else {
+		elseJump := c.EmitJump(vm.OP_JUMP_IF_FALSE, l.operator.Position)
+		endJump = c.EmitJump(vm.OP_JUMP, l.operator.Position)
+		err = c.PatchJump(elseJump)
+		if err != nil {
+			return err
+		}
+	}
+	c.EmitOp(vm.OP_POP, l.operator.Position)
+
+	err = l.right.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	return c.PatchJump(endJump)
+}
+
+func (m MapExpr) Compile(c *vm.Compiler) error {
+	for j := range m.keys {
+		err := m.keys[j].(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+		err = m.values[j].(Compilable).Compile(c)
+		if err != nil {
+			return err
+		}
+	}
+	return c.EmitBuildMap(len(m.keys), m.brace.Position)
+}
+
+func (s SetExpr) Compile(c *vm.Compiler) error {
+	err := s.obj.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	err = s.value.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+	return c.EmitNameOp(vm.OP_SET_PROPERTY, s.name)
+}
+
+func (s SuperExpr) Compile(c *vm.Compiler) error {
+	err := c.GetVariable(token.NewToken(token.THIS, "this", nil, s.keyword.Position, 0))
+	if err != nil {
+		return err
+	}
+	err = c.GetVariable(s.keyword)
+	if err != nil {
+		return err
+	}
+	return c.EmitNameOp(vm.OP_GET_SUPER, s.method)
+}
+
+func (t TernaryExpr) Compile(c *vm.Compiler) error {
+	err := t.condition.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	elseJump := c.EmitJump(vm.OP_JUMP_IF_FALSE, c.Position())
+	c.EmitOp(vm.OP_POP, c.Position())
+	err = t.left.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	endJump := c.EmitJump(vm.OP_JUMP, c.Position())
+	err = c.PatchJump(elseJump)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(vm.OP_POP, c.Position())
+	err = t.right.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	return c.PatchJump(endJump)
+}
+
+func (t ThisExpr) Compile(c *vm.Compiler) error {
+	return c.GetVariable(t.keyword)
+}
+
+func (u UnaryExpr) Compile(c *vm.Compiler) error {
+	err := u.right.(Compilable).Compile(c)
+	if err != nil {
+		return err
+	}
+
+	switch u.operator.TokenType {
+	case token.BANG:
+		c.EmitOp(vm.OP_NOT, u.operator.Position)
+	case token.MINUS:
+		c.EmitOp(vm.OP_NEGATE, u.operator.Position)
+	}
+	return nil
+}
+
+func (v VariableExpr) Compile(c *vm.Compiler) error {
+	return c.GetVariable(v.name)
+}
@@ -0,0 +1,429 @@
+package ast
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/faideww/glox/src/token"
+)
+
+type StepMode int
+
+const (
+	// STEP_CONTINUE runs until the next breakpoint
+	STEP_CONTINUE StepMode = iota
+	// STEP_IN pauses on the next line, including inside a call
+	STEP_IN
+	// STEP_OVER pauses on the next line of the current function, or of its
+	// caller once it returns
+	STEP_OVER
+	// STEP_OUT pauses once the current function has returned
+	STEP_OUT
+)
+
+// A PauseHandler is called whenever the debugger pauses. It can inspect the
+// program through the pause, and returns how to carry on. Returning an error
+// stops the program with that error.
+type PauseHandler func(pause *Pause) (StepMode, error)
+
+// A Debugger pauses the interpreter at breakpoints and while stepping through
+// a program. It only pauses when execution reaches a new line, so a line with
+// several statements on it is stepped over in one go.
+type Debugger struct {
+	handler PauseHandler
+	// breakpoints may be changed from another goroutine while the program runs
+	lock        sync.Mutex
+	breakpoints map[string]map[int]bool
+	mode        StepMode
+	// the call depth when the current step started
+	depth int
+	// where the previously executed statement was
+	lastFile  string
+	lastLine  int
+	lastDepth int
+}
+
+// NewDebugger creates a debugger that pauses on the first line of the program
+func NewDebugger(handler PauseHandler) *Debugger {
+	return &Debugger{
+		handler:     handler,
+		breakpoints: make(map[string]map[int]bool),
+		mode:        STEP_IN,
+	}
+}
+
+// WithDebugger runs programs under the control of a debugger
+func WithDebugger(d *Debugger) InterpreterOption {
+	return func(i *Interpreter) {
+		i.debugger = d
+	}
+}
+
+// SetMode sets how the program runs until it next pauses. Programs start
+// paused on their first line unless this is called before they run.
+func (d *Debugger) SetMode(mode StepMode) {
+	d.mode = mode
+}
+
+// SetBreakpoint sets a breakpoint on a line of a file. Files are matched by
+// their cleaned path, or by their base name if file has no directory.
+func (d *Debugger) SetBreakpoint(file string, line int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	file = filepath.Clean(file)
+	if d.breakpoints[file] == nil {
+		d.breakpoints[file] = make(map[int]bool)
+	}
+	d.breakpoints[file][line] = true
+}
+
+// ClearBreakpoint removes a breakpoint, reporting whether there was one
+func (d *Debugger) ClearBreakpoint(file string, line int) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	file = filepath.Clean(file)
+	if !d.breakpoints[file][line] {
+		return false
+	}
+	delete(d.breakpoints[file], line)
+	return true
+}
+
+// ClearBreakpoints removes every breakpoint in a file
+func (d *Debugger) ClearBreakpoints(file string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.breakpoints, filepath.Clean(file))
+}
+
+// A Breakpoint is a line of a file that the debugger pauses on
+type Breakpoint struct {
+	File string
+	Line int
+}
+
+// Breakpoints lists every breakpoint, ordered by file and line
+func (d *Debugger) Breakpoints() []Breakpoint {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	breakpoints := make([]Breakpoint, 0)
+	for file, lines := range d.breakpoints {
+		for line := range lines {
+			breakpoints = append(breakpoints, Breakpoint{file, line})
+		}
+	}
+	sort.Slice(breakpoints, func(a, b int) bool {
+		if breakpoints[a].File != breakpoints[b].File {
+			return breakpoints[a].File < breakpoints[b].File
+		}
+		return breakpoints[a].Line < breakpoints[b].Line
+	})
+	return breakpoints
+}
+
+func (d *Debugger) hasBreakpoint(file string, line int) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.breakpoints[filepath.Clean(file)][line] {
+		return true
+	}
+	return d.breakpoints[filepath.Base(file)][line]
+}
+
+// StatementLines lists, in order, the lines of a program that a breakpoint can
+// be hit on: those where a statement starts, including statements in the
+// bodies of functions, methods and lambdas
+func StatementLines(statements []Stmt) []int {
+	found := make(map[int]bool)
+	for _, stmt := range statements {
+		statementLines(stmt, found)
+	}
+	lines := make([]int, 0, len(found))
+	for line := range found {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+func statementLines(stmt Stmt, found map[int]bool) {
+	if stmt == nil {
+		return
+	}
+	if line := stmtToken(stmt).Line; line > 0 {
+		found[line] = true
+	}
+
+	switch stmt := stmt.(type) {
+	case BlockStmt:
+		for _, s := range stmt.statements {
+			statementLines(s, found)
+		}
+	case ClassStmt:
+		for _, method := range stmt.methods {
+			for _, s := range method.body {
+				statementLines(s, found)
+			}
+		}
+	case ExpressionStmt:
+		expressionLines(stmt.expression, found)
+	case ForStmt:
+		statementLines(stmt.loop, found)
+	case FunctionStmt:
+		for _, s := range stmt.body {
+			statementLines(s, found)
+		}
+	case IfStmt:
+		expressionLines(stmt.condition, found)
+		statementLines(stmt.thenBranch, found)
+		statementLines(stmt.elseBranch, found)
+	case PrintStmt:
+		expressionLines(stmt.expression, found)
+	case ReturnStmt:
+		expressionLines(stmt.value, found)
+	case ThrowStmt:
+		expressionLines(stmt.value, found)
+	case TryStmt:
+		// the try, catch and finally blocks themselves are run directly, so
+		// only the statements inside them are paused on
+		for _, block := range []*BlockStmt{&stmt.body, stmt.catchBlock, stmt.finallyBlock} {
+			if block == nil {
+				continue
+			}
+			for _, s := range block.statements {
+				statementLines(s, found)
+			}
+		}
+	case VarStmt:
+		expressionLines(stmt.initializer, found)
+	case WhileStmt:
+		expressionLines(stmt.condition, found)
+		statementLines(stmt.body, found)
+		statementLines(stmt.increment, found)
+	}
+}
+
+// Finds the statements in the bodies of any lambdas within expr
+func expressionLines(expr Expr, found map[int]bool) {
+	switch expr := expr.(type) {
+	case AssignmentExpr:
+		expressionLines(expr.value, found)
+	case BinaryExpr:
+		expressionLines(expr.left, found)
+		expressionLines(expr.right, found)
+	case CallExpr:
+		expressionLines(expr.callee, found)
+		for _, argument := range expr.arguments {
+			expressionLines(argument, found)
+		}
+	case FunctionExpr:
+		for _, s := range expr.body {
+			statementLines(s, found)
+		}
+	case GetExpr:
+		expressionLines(expr.object, found)
+	case GroupingExpr:
+		expressionLines(expr.expression, found)
+	case IndexExpr:
+		expressionLines(expr.object, found)
+		expressionLines(expr.index, found)
+	case IndexSetExpr:
+		expressionLines(expr.object, found)
+		expressionLines(expr.index, found)
+		expressionLines(expr.value, found)
+	case ListExpr:
+		for _, element := range expr.elements {
+			expressionLines(element, found)
+		}
+	case LogicalExpr:
+		expressionLines(expr.left, found)
+		expressionLines(expr.right, found)
+	case MapExpr:
+		for j := range expr.keys {
+			expressionLines(expr.keys[j], found)
+			expressionLines(expr.values[j], found)
+		}
+	case SetExpr:
+		expressionLines(expr.obj, found)
+		expressionLines(expr.value, found)
+	case TernaryExpr:
+		expressionLines(expr.condition, found)
+		expressionLines(expr.left, found)
+		expressionLines(expr.right, found)
+	case UnaryExpr:
+		expressionLines(expr.right, found)
+	}
+}
+
+// Called before every statement. Pauses if the statement starts a new line
+// that is either a breakpoint or where the current step ends.
+func (d *Debugger) before(i *Interpreter, stmt Stmt) error {
+	site := stmtToken(stmt)
+	file, line, depth := site.File(), site.Line, len(i.frames)
+	newLine := line != d.lastLine || file != d.lastFile || depth != d.lastDepth
+	d.lastFile, d.lastLine, d.lastDepth = file, line, depth
+	if !newLine || line == 0 {
+		return nil
+	}
+
+	reason := ""
+	switch {
+	case d.hasBreakpoint(file, line):
+		reason = "breakpoint"
+	case d.mode == STEP_IN,
+		d.mode == STEP_OVER && depth <= d.depth,
+		d.mode == STEP_OUT && depth < d.depth:
+		reason = "step"
+	default:
+		return nil
+	}
+
+	mode, err := d.handler(&Pause{i, site, reason})
+	if err != nil {
+		return err
+	}
+	d.mode = mode
+	d.depth = depth
+	return nil
+}
+
+// A Pause describes where the program stopped, and lets the debugger inspect
+// it
+type Pause struct {
+	interpreter *Interpreter
+	site        token.Token
+	// Reason is "breakpoint" or "step"
+	Reason string
+}
+
+// Position returns the position of the statement about to run
+func (p *Pause) Position() token.Position {
+	return p.site.Position
+}
+
+// A DebugFrame is one active call
+type DebugFrame struct {
+	// Name is the function, like "Point.init", or "<script>" for the top
+	// level
+	Name string
+	// Position is where the frame is currently executing
+	Position token.Position
+}
+
+// Stack returns the active calls, innermost first. Frames are numbered by
+// their index in the stack for Scopes, Lookup and Evaluate.
+func (p *Pause) Stack() []DebugFrame {
+	i := p.interpreter
+	stack := make([]DebugFrame, len(i.frames)+1)
+	for depth := range stack {
+		frame := DebugFrame{Name: "<script>"}
+		if depth > 0 {
+			frame.Name = i.frames[depth-1].String()
+		}
+		if depth < len(i.frames) {
+			frame.Position = i.callers[depth].site.Position
+		} else {
+			frame.Position = p.site.Position
+		}
+		stack[len(stack)-1-depth] = frame
+	}
+	return stack
+}
+
+// Returns the environment a frame is executing in
+func (p *Pause) env(frame int) *Environment {
+	i := p.interpreter
+	if frame <= 0 || frame > len(i.callers) {
+		return i.currentEnv
+	}
+	return i.callers[len(i.callers)-frame].env
+}
+
+// A DebugScope is one environment visible from a frame
+type DebugScope struct {
+	// Name is "local" or "global"
+	Name      string
+	Variables []DebugVariable
+}
+
+type DebugVariable struct {
+	Name  string
+	Value LoxValue
+}
+
+// Scopes walks a frame's environment chain from its innermost scope out to
+// its module's globals. The natives shared by every module are left out.
+func (p *Pause) Scopes(frame int) []DebugScope {
+	scopes := make([]DebugScope, 0)
+	for env := p.env(frame); env != nil && env != p.interpreter.builtins; env = env.parent {
+		name := "local"
+		if env.parent == p.interpreter.builtins {
+			name = "global"
+		}
+
+		variables := make([]DebugVariable, 0, len(env.variables))
+		for varName, value := range env.variables {
+			variables = append(variables, DebugVariable{varName, value})
+		}
+		sortVariables(variables)
+		scopes = append(scopes, DebugScope{name, variables})
+	}
+	return scopes
+}
+
+// Lookup finds the variable a name refers to in a frame
+func (p *Pause) Lookup(frame int, name string) (LoxValue, bool) {
+	return p.env(frame).Lookup(name)
+}
+
+// Evaluate evaluates an expression in a frame. Since the expression hasn't
+// been through the resolver, its variables are looked up by name through the
+// frame's environments. The debugger doesn't pause inside it, and it doesn't
+// count towards the program's limits.
+func (p *Pause) Evaluate(frame int, expr Expr) (LoxValue, error) {
+	i := p.interpreter
+	prevEnv, prevDebugger, prevUsage := i.currentEnv, i.debugger, i.usage
+	i.currentEnv, i.debugger, i.dynamicScope = p.env(frame), nil, true
+	defer func() {
+		i.currentEnv, i.debugger, i.usage, i.dynamicScope = prevEnv, prevDebugger, prevUsage, false
+	}()
+
+	return i.InterpretExpression(prevUsage.ctx, expr)
+}
+
+// Members lists the contents of a value that a debugger can expand: the
+// fields of an instance, the elements of a list or the entries of a map. Other
+// values have none.
+func Members(value LoxValue) []DebugVariable {
+	members := make([]DebugVariable, 0)
+	switch value := value.(type) {
+	case *LoxInstance:
+		for name, field := range value.fields {
+			members = append(members, DebugVariable{name, field})
+		}
+		sortVariables(members)
+	case *HostInstance:
+		for name, j := range value.fields {
+			field, _ := ToLox(value.value.Elem().Field(j).Interface())
+			members = append(members, DebugVariable{name, field})
+		}
+		sortVariables(members)
+	case *LoxList:
+		for j, element := range value.elements {
+			members = append(members, DebugVariable{fmt.Sprintf("[%d]", j), element})
+		}
+	case *LoxMap:
+		for _, key := range value.keys {
+			members = append(members, DebugVariable{ToString(key), value.entries[key]})
+		}
+	}
+	return members
+}
+
+func sortVariables(variables []DebugVariable) {
+	sort.Slice(variables, func(a, b int) bool {
+		return variables[a].Name < variables[b].Name
+	})
+}
@@ -0,0 +1,192 @@
+package ast_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/scanner"
+)
+
+const debugSource = `fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+fun twice(x) {
+  var once = add(x, x);
+  return add(once, once);
+}
+var result = twice(1);
+print result;
+`
+
+// debugRun runs debugSource under a debugger whose pause handler calls
+// inspect, then carries on with the next of modes (or continues once they run
+// out). It returns the lines the program paused on.
+func debugRun(t *testing.T, breakpoints []string, modes []ast.StepMode, inspect func(pause *ast.Pause)) []int {
+	t.Helper()
+	lines := make([]int, 0)
+	debugger := ast.NewDebugger(func(pause *ast.Pause) (ast.StepMode, error) {
+		lines = append(lines, pause.Position().Line)
+		if inspect != nil {
+			inspect(pause)
+		}
+		if len(modes) == 0 {
+			return ast.STEP_CONTINUE, nil
+		}
+		mode := modes[0]
+		modes = modes[1:]
+		return mode, nil
+	})
+	for _, breakpoint := range breakpoints {
+		debugger.SetBreakpoint(breakpoint, 3)
+	}
+
+	var out bytes.Buffer
+	i := ast.NewInterpreter(ast.WithDebugger(debugger), ast.WithStdout(&out))
+	reporter := errors.NewErrorReporter()
+	tokens, _ := scanner.NewScanner(debugSource, "test/debug.lox", reporter).ScanTokens()
+	statements, _ := ast.NewParser(tokens, reporter).Parse()
+	if !ast.NewResolver(i, reporter).Resolve(statements) {
+		t.Fatal(reporter.Err())
+	}
+	if err := i.Interpret(context.Background(), statements); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "4\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	return lines
+}
+
+func repeatMode(mode ast.StepMode, n int) []ast.StepMode {
+	modes := make([]ast.StepMode, n)
+	for j := range modes {
+		modes[j] = mode
+	}
+	return modes
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	cases := []struct {
+		name  string
+		modes []ast.StepMode
+		lines []int
+	}{
+		{"step", repeatMode(ast.STEP_IN, 20), []int{1, 5, 9, 6, 2, 3, 7, 2, 3, 10}},
+		{"next", repeatMode(ast.STEP_OVER, 20), []int{1, 5, 9, 10}},
+		{"next in a function", []ast.StepMode{ast.STEP_OVER, ast.STEP_OVER, ast.STEP_IN, ast.STEP_OVER, ast.STEP_OVER, ast.STEP_OVER}, []int{1, 5, 9, 6, 7, 10}},
+		{"out", []ast.StepMode{ast.STEP_IN, ast.STEP_IN, ast.STEP_IN, ast.STEP_IN, ast.STEP_OUT, ast.STEP_OUT}, []int{1, 5, 9, 6, 2, 7, 10}},
+		{"continue", []ast.StepMode{ast.STEP_CONTINUE}, []int{1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lines := debugRun(t, nil, c.modes, nil)
+			if !reflect.DeepEqual(lines, c.lines) {
+				t.Errorf("paused on lines %v, want %v", lines, c.lines)
+			}
+		})
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	cases := []struct {
+		file  string
+		lines []int
+	}{
+		{"test/debug.lox", []int{1, 3, 3}},
+		{"test/../test/debug.lox", []int{1, 3, 3}},
+		// a file without a directory matches by its base name
+		{"debug.lox", []int{1, 3, 3}},
+		{"other/debug.lox", []int{1}},
+	}
+	for _, c := range cases {
+		reasons := make([]string, 0)
+		lines := debugRun(t, []string{c.file}, []ast.StepMode{ast.STEP_CONTINUE}, func(pause *ast.Pause) {
+			reasons = append(reasons, pause.Reason)
+		})
+		if !reflect.DeepEqual(lines, c.lines) {
+			t.Errorf("%s: paused on lines %v, want %v", c.file, lines, c.lines)
+		}
+		if len(reasons) > 1 && reasons[1] != "breakpoint" {
+			t.Errorf("%s: paused for %q, want a breakpoint", c.file, reasons[1])
+		}
+	}
+}
+
+func TestDebuggerInspect(t *testing.T) {
+	pauses := 0
+	debugRun(t, []string{"debug.lox"}, []ast.StepMode{ast.STEP_CONTINUE, ast.STEP_CONTINUE}, func(pause *ast.Pause) {
+		pauses++
+		if pause.Position().Line != 3 {
+			return
+		}
+
+		stack := pause.Stack()
+		names := make([]string, len(stack))
+		lines := make([]int, len(stack))
+		for j, frame := range stack {
+			names[j], lines[j] = frame.Name, frame.Position.Line
+		}
+		wantLines := []int{3, 6, 9}
+		if pauses == 3 {
+			wantLines = []int{3, 7, 9}
+		}
+		if !reflect.DeepEqual(names, []string{"add", "twice", "<script>"}) || !reflect.DeepEqual(lines, wantLines) {
+			t.Errorf("stack = %v at lines %v", names, lines)
+		}
+
+		wantScopes := []ast.DebugScope{
+			{Name: "local", Variables: []ast.DebugVariable{{Name: "a", Value: 1.0}, {Name: "b", Value: 1.0}, {Name: "sum", Value: 2.0}}},
+			{Name: "global", Variables: []ast.DebugVariable{{Name: "add", Value: nil}, {Name: "twice", Value: nil}}},
+		}
+		if pauses == 3 {
+			wantScopes[0].Variables = []ast.DebugVariable{{Name: "a", Value: 2.0}, {Name: "b", Value: 2.0}, {Name: "sum", Value: 4.0}}
+		}
+		scopes := pause.Scopes(0)
+		// functions are only compared by name
+		for _, scope := range scopes {
+			for j, variable := range scope.Variables {
+				if _, ok := variable.Value.(*ast.LoxFunction); ok {
+					scope.Variables[j].Value = nil
+				}
+			}
+		}
+		if !reflect.DeepEqual(scopes, wantScopes) {
+			t.Errorf("scopes = %v, want %v", scopes, wantScopes)
+		}
+
+		// the caller's frame sees its own variables
+		if x, ok := pause.Lookup(1, "x"); !ok || x != 1.0 {
+			t.Errorf("Lookup(1, x) = %v, %v", x, ok)
+		}
+		if _, ok := pause.Lookup(0, "x"); ok {
+			t.Error("x shouldn't be visible from add")
+		}
+
+		checkEvaluate(t, pause, 0, "sum * 10", map[int]interface{}{2: 20.0, 3: 40.0}[pauses])
+		checkEvaluate(t, pause, 1, "x + 1", 2.0)
+		// calls made by the expression don't pause
+		checkEvaluate(t, pause, 2, "add(2, 3)", 5.0)
+	})
+	if pauses != 3 {
+		t.Errorf("paused %d times, want 3", pauses)
+	}
+}
+
+func checkEvaluate(t *testing.T, pause *ast.Pause, frame int, source string, want ast.LoxValue) {
+	t.Helper()
+	reporter := errors.NewErrorReporter()
+	tokens, _ := scanner.NewScanner(source, "<eval>", reporter).ScanTokens()
+	expr, ok := ast.NewParser(tokens, reporter).ParseExpression()
+	if !ok {
+		t.Fatal(reporter.Err())
+	}
+	value, err := pause.Evaluate(frame, expr)
+	if err != nil || value != want {
+		t.Errorf("Evaluate(%d, %s) = %v, %v, want %v", frame, source, value, err, want)
+	}
+}
@@ -30,6 +30,15 @@ func (e *Environment) Define(name string, value LoxValue) {
 	e.variables[name] = value
 }
 
+// Lookup finds a variable by name in this environment or its ancestors
+func (e *Environment) Lookup(name string) (LoxValue, bool) {
+	value, ok := e.variables[name]
+	if !ok && e.parent != nil {
+		return e.parent.Lookup(name)
+	}
+	return value, ok
+}
+
 func (e *Environment) Get(name token.Token) (LoxValue, error) {
 	value, ok := e.variables[name.Lexeme]
 	if ok {
@@ -40,8 +49,6 @@ func (e *Environment) Get(name token.Token) (LoxValue, error) {
 		return e.parent.Get(name)
 	}
 
-	fmt.Printf("%#v\n", e)
-
 	return nil, errors.NewRuntimeError(name, fmt.Sprintf("Undefined variable '%s'", name.Lexeme))
 }
 
@@ -40,9 +40,10 @@ func (cs ClassStmt) Evaluate(i *Interpreter) error {
 		i.currentEnv.Define("super", superclass)
 	}
 
-	methods := make(map[string]LoxFunction)
+	methods := make(map[string]*LoxFunction)
 	for _, method := range cs.methods {
-		fn := NewLoxFunction(method, i.currentEnv, method.name.Lexeme == "init")
+		fn := NewLoxFunction(method, i.currentEnv, method.name.Lexeme == "init", i.module)
+		fn.class = cs.name.Lexeme
 		methods[method.name.Lexeme] = fn
 	}
 
@@ -59,8 +60,12 @@ func (cs ContinueStmt) Evaluate(i *Interpreter) error {
 	return NewContinueException(cs.token)
 }
 
+func (fs ForStmt) Evaluate(i *Interpreter) error {
+	return fs.loop.(EvaluableStmt).Evaluate(i)
+}
+
 func (fs FunctionStmt) Evaluate(i *Interpreter) error {
-	function := NewLoxFunction(fs, i.currentEnv, false)
+	function := NewLoxFunction(fs, i.currentEnv, false, i.module)
 	i.currentEnv.Define(fs.name.Lexeme, function)
 	return nil
 }
@@ -71,12 +76,12 @@ func (is IfStmt) Evaluate(i *Interpreter) error {
 		return err
 	}
 	if isTruthy(cond) {
-		err := is.thenBranch.(EvaluableStmt).Evaluate(i)
+		err := i.execute(is.thenBranch)
 		if err != nil {
 			return err
 		}
 	} else if is.elseBranch != nil {
-		err := is.elseBranch.(EvaluableStmt).Evaluate(i)
+		err := i.execute(is.elseBranch)
 		if err != nil {
 			return err
 		}
@@ -84,13 +89,23 @@ func (is IfStmt) Evaluate(i *Interpreter) error {
 	return nil
 }
 
+func (is ImportStmt) Evaluate(i *Interpreter) error {
+	module, err := i.importModule(is.keyword, is.path.Literal.(string))
+	if err != nil {
+		return err
+	}
+
+	i.currentEnv.Define(is.name.Lexeme, module)
+	return nil
+}
+
 func (ps PrintStmt) Evaluate(i *Interpreter) error {
 	result, err := ps.expression.(Evaluable).Evaluate(i)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(ToString(result))
+	fmt.Fprintln(i.stdout, ToString(result))
 	return nil
 }
 
@@ -107,35 +122,77 @@ func (rs ReturnStmt) Evaluate(i *Interpreter) error {
 	return NewReturnException(rs.keyword, retVal)
 }
 
+func (ts ThrowStmt) Evaluate(i *Interpreter) error {
+	value, err := ts.value.(Evaluable).Evaluate(i)
+	if err != nil {
+		return err
+	}
+
+	// rethrowing a caught error preserves where it was originally raised
+	if loxErr, ok := value.(*LoxError); ok {
+		return NewThrowException(loxErr)
+	}
+
+	return NewThrowException(NewLoxError(ToString(value), ts.keyword, value, i.stackTrace()))
+}
+
+func (ts TryStmt) Evaluate(i *Interpreter) error {
+	err := ts.body.Evaluate(i)
+
+	if err != nil && ts.catchBlock != nil && !i.isInterrupted(err) {
+		i.attachTrace(err)
+		if loxErr, ok := toLoxError(err); ok {
+			prevEnv := i.currentEnv
+			i.currentEnv = NewEnvironment(prevEnv)
+			i.currentEnv.Define(ts.catchParam.Lexeme, loxErr)
+			err = ts.catchBlock.Evaluate(i)
+			i.currentEnv = prevEnv
+		}
+	}
+
+	if ts.finallyBlock != nil {
+		// an error (or return, break, etc.) raised by the finally block
+		// replaces whatever the try or catch blocks produced
+		finallyErr := ts.finallyBlock.Evaluate(i)
+		if finallyErr != nil {
+			return finallyErr
+		}
+	}
+
+	return err
+}
+
 func (ws WhileStmt) Evaluate(i *Interpreter) error {
-	cond, condErr := ws.condition.(Evaluable).Evaluate(i)
-	for condErr == nil && isTruthy(cond) {
-		bodyErr := ws.body.(EvaluableStmt).Evaluate(i)
-
-		shouldBreak := false
-		if bodyErr != nil {
-			switch bodyErr.(type) {
-			case *ContinueException:
-				continue
-			case *BreakException:
-				shouldBreak = true
-			default:
-				return bodyErr
-			}
+	for {
+		cond, err := ws.condition.(Evaluable).Evaluate(i)
+		if err != nil {
+			return err
+		}
+		if !isTruthy(cond) {
+			return nil
+		}
 
+		err = i.checkInterrupted(ws.keyword)
+		if err != nil {
+			return err
 		}
 
-		if shouldBreak {
-			break
+		bodyErr := i.execute(ws.body)
+		switch bodyErr.(type) {
+		case nil, *ContinueException:
+		case *BreakException:
+			return nil
+		default:
+			return bodyErr
 		}
 
-		cond, condErr = ws.condition.(Evaluable).Evaluate(i)
-	}
-	if condErr != nil {
-		return condErr
+		if ws.increment != nil {
+			err = i.execute(ws.increment)
+			if err != nil {
+				return err
+			}
+		}
 	}
-
-	return nil
 }
 
 func (es ExpressionStmt) Evaluate(i *Interpreter) error {
@@ -167,7 +224,7 @@ func (b BlockStmt) Evaluate(i *Interpreter) error {
 
 	var err error
 	for _, statement := range b.statements {
-		err = statement.(EvaluableStmt).Evaluate(i)
+		err = i.execute(statement)
 		if err != nil {
 			break
 		}
@@ -188,8 +245,10 @@ func (a AssignmentExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 		return nil, err
 	}
 
-	if hops, ok := i.locals[a]; ok {
+	if hops, ok := i.locals[a.name]; ok {
 		i.currentEnv.AssignAt(hops, a.name, value)
+	} else if i.dynamicScope {
+		err = i.currentEnv.Assign(a.name, value)
 	} else {
 		err = i.globals.Assign(a.name, value)
 	}
@@ -233,9 +292,9 @@ func (b BinaryExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 			return lFloat <= rFloat, nil
 		}
 	case token.BANG_EQUAL:
-		return left != right, nil
+		return !isEqual(left, right), nil
 	case token.EQUAL_EQUAL:
-		return left == right, nil
+		return isEqual(left, right), nil
 	case token.MINUS:
 		if lOk && rOk {
 			return lFloat - rFloat, nil
@@ -260,7 +319,8 @@ func (b BinaryExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 		_, rOk = right.(string)
 
 		if lOk || rOk {
-			return fmt.Sprintf("%s%s", ToString(left), ToString(right)), nil
+			result := fmt.Sprintf("%s%s", ToString(left), ToString(right))
+			return result, i.allocateString(b.operator, result)
 		}
 
 		return nil, errors.NewRuntimeError(b.operator, "Operands must be two numbers or two strings")
@@ -290,11 +350,47 @@ func (c CallExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 		return nil, errors.NewRuntimeError(c.paren, "Can only call functions and classes")
 	}
 
-	if fn.Arity() != len(argValues) {
+	err = i.checkInterrupted(c.paren)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := fn.(*LoxClass); ok {
+		err = i.allocateInstance(c.paren)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if fn.Arity() != VARIADIC && fn.Arity() != len(argValues) {
 		return nil, errors.NewRuntimeError(c.paren, fmt.Sprintf("Expected %d arguments but got %d", fn.Arity(), len(argValues)))
 	}
 
-	return fn.Call(argValues, i)
+	frame := callFrame(fn, c.paren)
+	err = i.pushFrame(frame, c.paren)
+	if err != nil {
+		return nil, err
+	}
+	if i.profiler != nil {
+		i.profiler.enter(frame, profileKind(fn))
+	}
+	value, err := fn.Call(argValues, i)
+	if i.profiler != nil {
+		i.profiler.exit()
+	}
+	if nativeErr, ok := err.(*NativeError); ok {
+		err = errors.NewRuntimeError(c.paren, nativeErr.message)
+	}
+	if _, ok := fn.(*NativeFunction); ok && err == nil {
+		err = i.allocateResult(c.paren, value)
+	}
+	i.attachTrace(err)
+	i.popFrame()
+	return value, err
+}
+
+func (f FunctionExpr) Evaluate(i *Interpreter) (LoxValue, error) {
+	return NewLoxLambda(f, i.currentEnv, i.module), nil
 }
 
 func (g GetExpr) Evaluate(i *Interpreter) (LoxValue, error) {
@@ -307,6 +403,18 @@ func (g GetExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 		return objInstance.Get(g.name)
 	}
 
+	if objModule, ok := obj.(*LoxModule); ok {
+		return objModule.Get(g.name)
+	}
+
+	if objHost, ok := obj.(*HostInstance); ok {
+		return objHost.Get(g.name)
+	}
+
+	if objError, ok := obj.(*LoxError); ok {
+		return objError.Get(g.name)
+	}
+
 	return nil, errors.NewRuntimeError(g.name, "Only instances can have properties")
 }
 
@@ -314,10 +422,135 @@ func (g GroupingExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 	return g.expression.(Evaluable).Evaluate(i)
 }
 
+func (ie IndexExpr) Evaluate(i *Interpreter) (LoxValue, error) {
+	obj, err := ie.object.(Evaluable).Evaluate(i)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := ie.index.(Evaluable).Evaluate(i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch obj := obj.(type) {
+	case *LoxList:
+		return obj.Get(ie.bracket, index)
+	case *LoxMap:
+		return obj.Get(ie.bracket, index)
+	}
+
+	return nil, errors.NewRuntimeError(ie.bracket, "Only lists and maps can be indexed")
+}
+
+func (is IndexSetExpr) Evaluate(i *Interpreter) (LoxValue, error) {
+	obj, err := is.object.(Evaluable).Evaluate(i)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := is.index.(Evaluable).Evaluate(i)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := is.value.(Evaluable).Evaluate(i)
+	if err != nil {
+		return nil, err
+	}
+
+	switch obj := obj.(type) {
+	case *LoxList:
+		err = obj.Set(is.bracket, index, value)
+	case *LoxMap:
+		if !obj.Has(index) {
+			err = i.allocateElements(is.bracket, 1)
+		}
+		if err == nil {
+			err = obj.Set(is.bracket, index, value)
+		}
+	default:
+		err = errors.NewRuntimeError(is.bracket, "Only lists and maps can be indexed")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (l ListExpr) Evaluate(i *Interpreter) (LoxValue, error) {
+	err := i.allocateInstance(l.bracket)
+	if err != nil {
+		return nil, err
+	}
+	err = i.allocateElements(l.bracket, len(l.elements))
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([]LoxValue, len(l.elements))
+	for j, elementExpr := range l.elements {
+		v, err := elementExpr.(Evaluable).Evaluate(i)
+		if err != nil {
+			return nil, err
+		}
+		elements[j] = v
+	}
+
+	return NewLoxList(elements), nil
+}
+
 func (l LiteralExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 	return l.value, nil
 }
 
+func (l LogicalExpr) Evaluate(i *Interpreter) (LoxValue, error) {
+	left, err := l.left.(Evaluable).Evaluate(i)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.operator.TokenType == token.OR {
+		if isTruthy(left) {
+			return left, nil
+		}
+	} else if !isTruthy(left) {
+		return left, nil
+	}
+
+	return l.right.(Evaluable).Evaluate(i)
+}
+
+func (m MapExpr) Evaluate(i *Interpreter) (LoxValue, error) {
+	err := i.allocateInstance(m.brace)
+	if err != nil {
+		return nil, err
+	}
+	err = i.allocateElements(m.brace, len(m.keys))
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewLoxMap()
+	for j := range m.keys {
+		key, err := m.keys[j].(Evaluable).Evaluate(i)
+		if err != nil {
+			return nil, err
+		}
+		value, err := m.values[j].(Evaluable).Evaluate(i)
+		if err != nil {
+			return nil, err
+		}
+		err = result.Set(m.brace, key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
 func (s SetExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 	obj, err := s.obj.(Evaluable).Evaluate(i)
 	if err != nil {
@@ -332,11 +565,18 @@ func (s SetExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 		instanceObj.Set(s.name, value)
 		return value, nil
 	}
+	if hostObj, ok := obj.(*HostInstance); ok {
+		value, err := s.value.(Evaluable).Evaluate(i)
+		if err != nil {
+			return nil, err
+		}
+		return value, hostObj.Set(s.name, value)
+	}
 	return nil, errors.NewRuntimeError(s.name, "Only instances have fields")
 }
 
 func (s SuperExpr) Evaluate(i *Interpreter) (LoxValue, error) {
-	distance := i.locals[s]
+	distance := i.locals[s.keyword]
 	superclass := i.currentEnv.GetAt(distance, "super").(*LoxClass)
 
 	instance := i.currentEnv.GetAt(distance-1, "this").(*LoxInstance)
@@ -375,7 +615,7 @@ func (t TernaryExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 }
 
 func (t ThisExpr) Evaluate(i *Interpreter) (LoxValue, error) {
-	return i.lookupVariable(t.keyword, t)
+	return i.lookupVariable(t.keyword)
 }
 
 func (u UnaryExpr) Evaluate(i *Interpreter) (LoxValue, error) {
@@ -400,7 +640,7 @@ func (u UnaryExpr) Evaluate(i *Interpreter) (LoxValue, error) {
 }
 
 func (v VariableExpr) Evaluate(i *Interpreter) (LoxValue, error) {
-	return i.lookupVariable(v.name, v)
+	return i.lookupVariable(v.name)
 }
 
 func isTruthy(value LoxValue) bool {
@@ -414,6 +654,21 @@ func isTruthy(value LoxValue) bool {
 	return true
 }
 
+// isEqual is the == operator. nil, booleans, numbers and strings are equal
+// when their values are, so NaN isn't equal to itself. Functions, classes,
+// instances, lists, maps and the other runtime values are only equal to
+// themselves.
+func isEqual(a LoxValue, b LoxValue) bool {
+	switch a.(type) {
+	case nil, bool, float64, string:
+		return a == b
+	case *LoxFunction, *NativeFunction, *LoxClass, *LoxInstance, *LoxList, *LoxMap, *LoxModule, *LoxError, *HostInstance:
+		// pointers, so comparing them compares their identity
+		return a == b
+	}
+	return false
+}
+
 func safeDivide(a, b float64) (float64, bool) {
 	if b == 0 {
 		return math.NaN(), false
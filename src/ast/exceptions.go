@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"fmt"
+
 	"github.com/faideww/glox/src/errors"
 	"github.com/faideww/glox/src/token"
 )
@@ -41,3 +43,85 @@ func (e *ReturnException) Error() string {
 func NewReturnException(token token.Token, value LoxValue) *ReturnException {
 	return &ReturnException{token, value}
 }
+
+// ExitException is raised by os.exit() to stop the program with an exit code
+type ExitException struct {
+	code int
+}
+
+func (e *ExitException) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e *ExitException) Code() int {
+	return e.code
+}
+
+func NewExitException(code int) *ExitException {
+	return &ExitException{code}
+}
+
+// LoxError is the value bound by a catch clause. It wraps both values raised
+// by throw statements and runtime errors raised by the interpreter itself.
+type LoxError struct {
+	message string
+	token   token.Token
+	value   LoxValue
+	trace   []errors.StackFrame
+}
+
+func NewLoxError(message string, token token.Token, value LoxValue, trace []errors.StackFrame) *LoxError {
+	return &LoxError{message, token, value, trace}
+}
+
+func (e *LoxError) String() string {
+	return e.message
+}
+
+func (e *LoxError) Get(name token.Token) (LoxValue, error) {
+	switch name.Lexeme {
+	case "message":
+		return e.message, nil
+	case "line":
+		return float64(e.token.Line), nil
+	case "value":
+		return e.value, nil
+	}
+	return nil, errors.NewRuntimeError(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme))
+}
+
+type ThrowException struct {
+	err *LoxError
+}
+
+func (e *ThrowException) Error() string {
+	return e.RuntimeError().Error()
+}
+
+func (e *ThrowException) Traceback() string {
+	return e.RuntimeError().Traceback()
+}
+
+// RuntimeError describes an exception that was never caught as a runtime
+// error raised where it was thrown
+func (e *ThrowException) RuntimeError() *errors.RuntimeError {
+	err := errors.NewRuntimeError(e.err.token, fmt.Sprintf("Uncaught exception: %s", e.err.message))
+	err.SetTrace(e.err.trace)
+	return err
+}
+
+func NewThrowException(err *LoxError) *ThrowException {
+	return &ThrowException{err}
+}
+
+// Converts an error into the value a catch clause should receive. Control flow
+// exceptions (return, break, continue, exit) are not catchable.
+func toLoxError(err error) (*LoxError, bool) {
+	switch err := err.(type) {
+	case *ThrowException:
+		return err.err, true
+	case *errors.RuntimeError:
+		return NewLoxError(err.Message(), err.Token(), nil, err.Trace()), true
+	}
+	return nil, false
+}
@@ -26,16 +26,42 @@ type CallExpr struct {
 	arguments []Expr
 }
 
+type FunctionExpr struct {
+	keyword token.Token
+	params  []token.Token
+	body    []Stmt
+}
+
 type GetExpr struct {
 	object Expr
 	name   token.Token
 }
 
 type GroupingExpr struct {
+	paren      token.Token
 	expression Expr
 }
 
+type IndexExpr struct {
+	object  Expr
+	bracket token.Token
+	index   Expr
+}
+
+type IndexSetExpr struct {
+	object  Expr
+	bracket token.Token
+	index   Expr
+	value   Expr
+}
+
+type ListExpr struct {
+	bracket  token.Token
+	elements []Expr
+}
+
 type LiteralExpr struct {
+	token token.Token
 	value LoxValue
 }
 
@@ -45,6 +71,12 @@ type LogicalExpr struct {
 	right    Expr
 }
 
+type MapExpr struct {
+	brace  token.Token
+	keys   []Expr
+	values []Expr
+}
+
 type SetExpr struct {
 	obj   Expr
 	name  token.Token
@@ -74,3 +106,47 @@ type UnaryExpr struct {
 type VariableExpr struct {
 	name token.Token
 }
+
+// exprToken returns the token an expression's runtime errors are reported at,
+// such as its operator
+func exprToken(expr Expr) token.Token {
+	switch expr := expr.(type) {
+	case AssignmentExpr:
+		return expr.name
+	case BinaryExpr:
+		return expr.operator
+	case CallExpr:
+		return expr.paren
+	case FunctionExpr:
+		return expr.keyword
+	case GetExpr:
+		return expr.name
+	case GroupingExpr:
+		return expr.paren
+	case IndexExpr:
+		return expr.bracket
+	case IndexSetExpr:
+		return expr.bracket
+	case ListExpr:
+		return expr.bracket
+	case LiteralExpr:
+		return expr.token
+	case LogicalExpr:
+		return expr.operator
+	case MapExpr:
+		return expr.brace
+	case SetExpr:
+		return expr.name
+	case SuperExpr:
+		return expr.keyword
+	case TernaryExpr:
+		return exprToken(expr.condition)
+	case ThisExpr:
+		return expr.keyword
+	case UnaryExpr:
+		return expr.operator
+	case VariableExpr:
+		return expr.name
+	}
+	return token.Token{}
+}
@@ -0,0 +1,270 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/faideww/glox/src/token"
+)
+
+func (bs BlockStmt) Format(f *Formatter) {
+	f.block(bs.brace, bs.statements)
+}
+
+func (bs BreakStmt) Format(f *Formatter) {
+	f.write("break;")
+}
+
+func (cs ClassStmt) Format(f *Formatter) {
+	f.write("class " + cs.name.Lexeme)
+	if cs.superclass != nil {
+		f.write(" < " + cs.superclass.name.Lexeme)
+	}
+	f.write(" ")
+
+	f.braces(f.following(cs.name, token.LEFT_BRACE), len(cs.methods) == 0, func() {
+		for _, method := range cs.methods {
+			f.flushComments(method.name.Start)
+			f.item(method.name.Position)
+			f.write(method.name.Lexeme)
+			f.function(method.name, method.params, method.body)
+		}
+	})
+}
+
+func (cs ContinueStmt) Format(f *Formatter) {
+	f.write("continue;")
+}
+
+func (es ExpressionStmt) Format(f *Formatter) {
+	es.expression.(Formattable).Format(f)
+	f.write(";")
+}
+
+func (fs ForStmt) Format(f *Formatter) {
+	f.write("for (")
+	if fs.initializer != nil {
+		fs.initializer.(Formattable).Format(f)
+	} else {
+		f.write(";")
+	}
+	if fs.condition != nil {
+		f.write(" ")
+		fs.condition.(Formattable).Format(f)
+	}
+	f.write(";")
+	if fs.increment != nil {
+		f.write(" ")
+		fs.increment.(Formattable).Format(f)
+	}
+	f.write(")")
+	f.body(fs.body)
+}
+
+func (fs FunctionStmt) Format(f *Formatter) {
+	f.write("fun " + fs.name.Lexeme)
+	f.function(fs.name, fs.params, fs.body)
+}
+
+func (is IfStmt) Format(f *Formatter) {
+	f.write("if (")
+	is.condition.(Formattable).Format(f)
+	f.write(")")
+	f.body(is.thenBranch)
+
+	if is.elseBranch == nil {
+		return
+	}
+	if _, ok := is.thenBranch.(BlockStmt); ok {
+		f.write(" else")
+	} else {
+		f.line()
+		f.write("else")
+	}
+	// else-if chains stay on the same line
+	if elseIf, ok := is.elseBranch.(IfStmt); ok {
+		f.write(" ")
+		elseIf.Format(f)
+		return
+	}
+	f.body(is.elseBranch)
+}
+
+func (is ImportStmt) Format(f *Formatter) {
+	f.write(fmt.Sprintf("import %s as %s;", is.path.Lexeme, is.name.Lexeme))
+}
+
+func (ps PrintStmt) Format(f *Formatter) {
+	f.write("print ")
+	ps.expression.(Formattable).Format(f)
+	f.write(";")
+}
+
+func (rs ReturnStmt) Format(f *Formatter) {
+	f.write("return")
+	if rs.value != nil {
+		f.write(" ")
+		rs.value.(Formattable).Format(f)
+	}
+	f.write(";")
+}
+
+func (ts ThrowStmt) Format(f *Formatter) {
+	f.write("throw ")
+	ts.value.(Formattable).Format(f)
+	f.write(";")
+}
+
+func (ts TryStmt) Format(f *Formatter) {
+	f.write("try ")
+	ts.body.Format(f)
+	if ts.catchBlock != nil {
+		f.write(fmt.Sprintf(" catch (%s) ", ts.catchParam.Lexeme))
+		ts.catchBlock.Format(f)
+	}
+	if ts.finallyBlock != nil {
+		f.write(" finally ")
+		ts.finallyBlock.Format(f)
+	}
+}
+
+func (vs VarStmt) Format(f *Formatter) {
+	f.write("var " + vs.name.Lexeme)
+	if vs.initializer != nil {
+		f.write(" = ")
+		vs.initializer.(Formattable).Format(f)
+	}
+	f.write(";")
+}
+
+func (ws WhileStmt) Format(f *Formatter) {
+	f.write("while (")
+	ws.condition.(Formattable).Format(f)
+	f.write(")")
+	f.body(ws.body)
+}
+
+func (a AssignmentExpr) Format(f *Formatter) {
+	f.write(a.name.Lexeme + " = ")
+	a.value.(Formattable).Format(f)
+}
+
+func (b BinaryExpr) Format(f *Formatter) {
+	b.left.(Formattable).Format(f)
+	f.write(" " + b.operator.Lexeme + " ")
+	b.right.(Formattable).Format(f)
+}
+
+func (c CallExpr) Format(f *Formatter) {
+	c.callee.(Formattable).Format(f)
+	f.write("(")
+	f.expressions(c.arguments)
+	f.write(")")
+}
+
+func (fe FunctionExpr) Format(f *Formatter) {
+	f.write("fun ")
+	f.function(fe.keyword, fe.params, fe.body)
+}
+
+func (g GetExpr) Format(f *Formatter) {
+	g.object.(Formattable).Format(f)
+	f.write("." + g.name.Lexeme)
+}
+
+func (g GroupingExpr) Format(f *Formatter) {
+	f.write("(")
+	g.expression.(Formattable).Format(f)
+	f.write(")")
+}
+
+func (ie IndexExpr) Format(f *Formatter) {
+	ie.object.(Formattable).Format(f)
+	f.write("[")
+	ie.index.(Formattable).Format(f)
+	f.write("]")
+}
+
+func (is IndexSetExpr) Format(f *Formatter) {
+	is.object.(Formattable).Format(f)
+	f.write("[")
+	is.index.(Formattable).Format(f)
+	f.write("] = ")
+	is.value.(Formattable).Format(f)
+}
+
+func (l ListExpr) Format(f *Formatter) {
+	f.write("[")
+	f.expressions(l.elements)
+	f.write("]")
+}
+
+// Literals are printed as they were written, so that numbers keep their
+// formatting
+func (l LiteralExpr) Format(f *Formatter) {
+	if l.token.Lexeme != "" {
+		f.write(l.token.Lexeme)
+		return
+	}
+
+	switch value := l.value.(type) {
+	case nil:
+		f.write("nil")
+	case string:
+		f.write(`"` + value + `"`)
+	case float64:
+		f.write(strconv.FormatFloat(value, 'f', -1, 64))
+	default:
+		f.write(fmt.Sprintf("%v", value))
+	}
+}
+
+func (l LogicalExpr) Format(f *Formatter) {
+	l.left.(Formattable).Format(f)
+	f.write(" " + l.operator.Lexeme + " ")
+	l.right.(Formattable).Format(f)
+}
+
+func (m MapExpr) Format(f *Formatter) {
+	f.write("{")
+	for i, key := range m.keys {
+		if i > 0 {
+			f.write(", ")
+		}
+		key.(Formattable).Format(f)
+		f.write(": ")
+		m.values[i].(Formattable).Format(f)
+	}
+	f.write("}")
+}
+
+func (s SetExpr) Format(f *Formatter) {
+	s.obj.(Formattable).Format(f)
+	f.write("." + s.name.Lexeme + " = ")
+	s.value.(Formattable).Format(f)
+}
+
+func (s SuperExpr) Format(f *Formatter) {
+	f.write("super." + s.method.Lexeme)
+}
+
+func (t TernaryExpr) Format(f *Formatter) {
+	t.condition.(Formattable).Format(f)
+	f.write(" ? ")
+	t.left.(Formattable).Format(f)
+	f.write(" : ")
+	t.right.(Formattable).Format(f)
+}
+
+func (t ThisExpr) Format(f *Formatter) {
+	f.write("this")
+}
+
+func (u UnaryExpr) Format(f *Formatter) {
+	f.write(u.operator.Lexeme)
+	u.right.(Formattable).Format(f)
+}
+
+func (v VariableExpr) Format(f *Formatter) {
+	f.write(v.name.Lexeme)
+}
@@ -0,0 +1,360 @@
+package ast
+
+import (
+	"math"
+	"strings"
+
+	"github.com/faideww/glox/src/token"
+)
+
+const FORMAT_INDENT = "  "
+
+// A Formatter prints a parsed program back out as source code in a canonical
+// style: two spaces of indentation, one statement per line and single spaces
+// around binary operators. Comments are put back among the statements around
+// them, and runs of blank lines between statements are collapsed into one.
+//
+// Comments inside an expression can't be put back exactly where they were,
+// so they're moved to the end of the statement's line (if they followed code
+// on their line) or onto their own line before the next statement.
+type Formatter struct {
+	lines    []string
+	indent   int
+	tokens   []token.Token
+	indexes  map[int]int
+	comments []token.Token
+	// fresh is set at the start of the file and of each block, where blank
+	// lines are dropped
+	fresh bool
+	// lineComment is set when the last line ends in a // comment, which would
+	// swallow anything else appended to the line
+	lineComment bool
+}
+
+// NewFormatter creates a formatter for a program parsed from tokens. The
+// tokens are used to find the braces and brackets that the syntax tree
+// doesn't keep track of.
+func NewFormatter(tokens []token.Token, comments []token.Token) *Formatter {
+	indexes := make(map[int]int)
+	for i, t := range tokens {
+		indexes[t.Start] = i
+	}
+	return &Formatter{
+		lines:    make([]string, 0),
+		tokens:   tokens,
+		indexes:  indexes,
+		comments: comments,
+	}
+}
+
+type Formattable interface {
+	Format(f *Formatter)
+}
+
+// Format returns the formatted source of the program
+func (f *Formatter) Format(statements []Stmt) string {
+	f.fresh = true
+	for _, stmt := range statements {
+		f.statement(stmt)
+	}
+	f.flushComments(math.MaxInt)
+
+	if len(f.lines) == 0 {
+		return ""
+	}
+	return strings.Join(f.lines, "\n") + "\n"
+}
+
+func (f *Formatter) statement(stmt Stmt) {
+	start := f.start(stmt)
+	f.flushComments(start.Start)
+	f.item(start.Position)
+	stmt.(Formattable).Format(f)
+}
+
+// write appends text to the current line
+func (f *Formatter) write(text string) {
+	f.lines[len(f.lines)-1] += text
+}
+
+// line starts a new, indented line
+func (f *Formatter) line() {
+	f.lines = append(f.lines, strings.Repeat(FORMAT_INDENT, f.indent))
+	f.fresh = false
+	f.lineComment = false
+}
+
+// item starts the line for a statement or comment at pos, keeping a blank line
+// before it if there was one in the source
+func (f *Formatter) item(pos token.Position) {
+	if !f.fresh && blankLineBefore(pos) {
+		f.lines = append(f.lines, "")
+	}
+	f.line()
+}
+
+// flushComments prints every comment before the given offset. A comment that
+// followed some code on its line stays at the end of the current line.
+func (f *Formatter) flushComments(offset int) {
+	for len(f.comments) > 0 && f.comments[0].Start < offset {
+		comment := f.comments[0]
+		f.comments = f.comments[1:]
+
+		if trailing(comment) && len(f.lines) > 0 && !f.lineComment {
+			f.write(" " + comment.Lexeme)
+		} else {
+			f.item(comment.Position)
+			f.write(comment.Lexeme)
+		}
+		f.lineComment = strings.HasPrefix(comment.Lexeme, "//")
+	}
+}
+
+func (f *Formatter) hasComments(offset int) bool {
+	return len(f.comments) > 0 && f.comments[0].Start < offset
+}
+
+// braces prints a brace-delimited body, with any comments at the end of it
+// kept inside. Bodies with nothing in them are printed as "{}".
+func (f *Formatter) braces(brace token.Token, empty bool, contents func()) {
+	closing := f.closing(brace)
+	if empty && !f.hasComments(closing.Start) {
+		f.write("{}")
+		return
+	}
+
+	f.write("{")
+	f.indent++
+	f.fresh = true
+	contents()
+	f.flushComments(closing.Start)
+	f.indent--
+	f.line()
+	f.write("}")
+}
+
+func (f *Formatter) block(brace token.Token, statements []Stmt) {
+	f.braces(brace, len(statements) == 0, func() {
+		for _, stmt := range statements {
+			f.statement(stmt)
+		}
+	})
+}
+
+// body prints the body of a control flow statement: a block goes on the same
+// line, and anything else is indented on the next line
+func (f *Formatter) body(stmt Stmt) {
+	if block, ok := stmt.(BlockStmt); ok {
+		f.write(" ")
+		block.Format(f)
+		return
+	}
+
+	f.indent++
+	f.fresh = true
+	f.statement(stmt)
+	f.indent--
+}
+
+func (f *Formatter) function(keyword token.Token, params []token.Token, body []Stmt) {
+	f.write("(")
+	for i, param := range params {
+		if i > 0 {
+			f.write(", ")
+		}
+		f.write(param.Lexeme)
+	}
+	f.write(") ")
+	f.block(f.following(keyword, token.LEFT_BRACE), body)
+}
+
+func (f *Formatter) expressions(exprs []Expr) {
+	for i, expr := range exprs {
+		if i > 0 {
+			f.write(", ")
+		}
+		expr.(Formattable).Format(f)
+	}
+}
+
+// start returns the first token of a statement
+func (f *Formatter) start(stmt Stmt) token.Token {
+	switch stmt := stmt.(type) {
+	case BlockStmt:
+		return stmt.brace
+	case BreakStmt:
+		return stmt.token
+	case ClassStmt:
+		return f.preceding(stmt.name)
+	case ContinueStmt:
+		return stmt.token
+	case ExpressionStmt:
+		return f.exprStart(stmt.expression)
+	case ForStmt:
+		return stmt.keyword
+	case FunctionStmt:
+		return f.preceding(stmt.name)
+	case IfStmt:
+		return stmt.keyword
+	case ImportStmt:
+		return stmt.keyword
+	case PrintStmt:
+		return stmt.keyword
+	case ReturnStmt:
+		return stmt.keyword
+	case ThrowStmt:
+		return stmt.keyword
+	case TryStmt:
+		return stmt.keyword
+	case VarStmt:
+		return stmt.keyword
+	case WhileStmt:
+		return stmt.keyword
+	}
+	return token.Token{}
+}
+
+// exprStart returns the first token of an expression
+func (f *Formatter) exprStart(expr Expr) token.Token {
+	switch expr := expr.(type) {
+	case AssignmentExpr:
+		return expr.name
+	case BinaryExpr:
+		return f.exprStart(expr.left)
+	case CallExpr:
+		return f.exprStart(expr.callee)
+	case FunctionExpr:
+		return expr.keyword
+	case GetExpr:
+		return f.exprStart(expr.object)
+	case GroupingExpr:
+		return expr.paren
+	case IndexExpr:
+		return f.exprStart(expr.object)
+	case IndexSetExpr:
+		return f.exprStart(expr.object)
+	case ListExpr:
+		return f.opening(expr.bracket)
+	case LiteralExpr:
+		return expr.token
+	case LogicalExpr:
+		return f.exprStart(expr.left)
+	case MapExpr:
+		return f.opening(expr.brace)
+	case SetExpr:
+		return f.exprStart(expr.obj)
+	case SuperExpr:
+		return expr.keyword
+	case TernaryExpr:
+		return f.exprStart(expr.condition)
+	case ThisExpr:
+		return expr.keyword
+	case UnaryExpr:
+		return expr.operator
+	case VariableExpr:
+		return expr.name
+	}
+	return token.Token{}
+}
+
+func (f *Formatter) preceding(t token.Token) token.Token {
+	i, ok := f.indexes[t.Start]
+	if !ok || i == 0 {
+		return t
+	}
+	return f.tokens[i-1]
+}
+
+// following returns the first token of the given type after t
+func (f *Formatter) following(t token.Token, tokenType token.TokenType) token.Token {
+	i, ok := f.indexes[t.Start]
+	if !ok {
+		return f.eof()
+	}
+	for ; i < len(f.tokens); i++ {
+		if f.tokens[i].TokenType == tokenType {
+			return f.tokens[i]
+		}
+	}
+	return f.eof()
+}
+
+// closing returns the brace or bracket that matches an opening one
+func (f *Formatter) closing(open token.Token) token.Token {
+	i, ok := f.indexes[open.Start]
+	if !ok {
+		return f.eof()
+	}
+
+	depth := 0
+	for ; i < len(f.tokens); i++ {
+		switch f.tokens[i].TokenType {
+		case token.LEFT_BRACE, token.LEFT_BRACKET, token.LEFT_PAREN:
+			depth++
+		case token.RIGHT_BRACE, token.RIGHT_BRACKET, token.RIGHT_PAREN:
+			depth--
+			if depth == 0 {
+				return f.tokens[i]
+			}
+		}
+	}
+	return f.eof()
+}
+
+// opening returns the brace or bracket that matches a closing one
+func (f *Formatter) opening(close token.Token) token.Token {
+	i, ok := f.indexes[close.Start]
+	if !ok {
+		return close
+	}
+
+	depth := 0
+	for ; i >= 0; i-- {
+		switch f.tokens[i].TokenType {
+		case token.RIGHT_BRACE, token.RIGHT_BRACKET, token.RIGHT_PAREN:
+			depth++
+		case token.LEFT_BRACE, token.LEFT_BRACKET, token.LEFT_PAREN:
+			depth--
+			if depth == 0 {
+				return f.tokens[i]
+			}
+		}
+	}
+	return close
+}
+
+func (f *Formatter) eof() token.Token {
+	return f.tokens[len(f.tokens)-1]
+}
+
+// trailing reports whether a comment follows some code on the same line
+func trailing(comment token.Token) bool {
+	if comment.Source == nil {
+		return false
+	}
+	line := []rune(comment.Source.LineText(comment.Line))
+	if comment.Column-1 > len(line) {
+		return false
+	}
+	return strings.TrimSpace(string(line[:comment.Column-1])) != ""
+}
+
+// blankLineBefore reports whether there's an empty line between pos and
+// whatever comes before it in the source
+func blankLineBefore(pos token.Position) bool {
+	if pos.Source == nil {
+		return false
+	}
+
+	newlines := 0
+	for i := pos.Start - 1; i >= 0; i-- {
+		switch pos.Source.Text[i] {
+		case '\n':
+			newlines++
+		case ' ', '\t', '\r':
+		default:
+			return newlines > 1
+		}
+	}
+	return false
+}
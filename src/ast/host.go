@@ -0,0 +1,507 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+)
+
+// Host values are Go functions and structs exposed to Lox programs. Values are
+// converted between the two languages as follows:
+//
+//	nil                 nil pointers, slices, maps, funcs and interfaces
+//	number              every integer and float kind; integers must be whole
+//	string, bool        any string or bool kind
+//	list                slices and arrays
+//	map                 maps with string, number or bool keys
+//	instance            structs and pointers to structs, as a *HostInstance
+//	native function     funcs, through NewHostFunction
+//
+// Parameters whose type a Lox value is already assignable to, like LoxValue,
+// Callable or *LoxList, receive the value unchanged.
+//
+// Values converted by ToLox are copies. The fields of a host instance are
+// views instead: a struct field is an instance of its own, and slice, array
+// and map fields are lists and maps that write changes to their elements back
+// to the Go value.
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// NewHostFunction wraps a Go function as a native function. Arguments are
+// converted to the types of its parameters, and a variadic function accepts
+// any number of arguments after its fixed ones. It may return nothing, one
+// value, an error, or a value followed by an error. Returned errors become
+// runtime errors at the call site, as do panics.
+func NewHostFunction(name string, fn interface{}) (*NativeFunction, error) {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s is a %T, not a function", name, fn)
+	}
+
+	fnType := value.Type()
+	if !canReturn(fnType) {
+		return nil, fmt.Errorf("%s must return at most one value and an error", name)
+	}
+
+	arity := fnType.NumIn()
+	if fnType.IsVariadic() {
+		arity = VARIADIC
+	}
+
+	native := NewNativeFunction(fixedArity(arity), nil)
+	native.name = name
+	native.call = func(args []LoxValue, _ *Interpreter) (result LoxValue, err error) {
+		in, err := hostArgs(native.name, fnType, args)
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = nil, NewNativeError(fmt.Sprintf("%s() panicked: %v", native.name, r))
+			}
+		}()
+		return hostResults(value.Call(in))
+	}
+	return native, nil
+}
+
+func canReturn(fnType reflect.Type) bool {
+	results := fnType.NumOut()
+	return results < 2 || (results == 2 && fnType.Out(1) == errorType)
+}
+
+// Converts the arguments of a call to a host function
+func hostArgs(name string, fnType reflect.Type, args []LoxValue) ([]reflect.Value, error) {
+	fixed := fnType.NumIn()
+	if fnType.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, NewNativeError(fmt.Sprintf("Expected at least %d arguments but got %d", fixed, len(args)))
+		}
+	}
+
+	in := make([]reflect.Value, len(args))
+	for j, arg := range args {
+		paramType := fnType.In(min(j, fnType.NumIn()-1))
+		if j >= fixed && fnType.IsVariadic() {
+			paramType = paramType.Elem()
+		}
+
+		converted, ok := FromLox(arg, paramType)
+		if !ok {
+			return nil, NewNativeError(fmt.Sprintf("%s() expects argument %d to be %s", name, j+1, describeType(paramType)))
+		}
+		in[j] = converted
+	}
+	return in, nil
+}
+
+// Converts the results of a call to a host function, treating a trailing
+// error as the error of the call
+func hostResults(out []reflect.Value) (LoxValue, error) {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err := out[len(out)-1].Interface(); err != nil {
+			return nil, hostError(err.(error))
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	result, err := ToLox(out[0].Interface())
+	if err != nil {
+		return nil, NewNativeError(err.Error())
+	}
+	return result, nil
+}
+
+// Errors the interpreter already knows how to handle, like an ExitException,
+// are passed through. Anything else becomes a runtime error at the call site.
+func hostError(err error) error {
+	switch err.(type) {
+	case *NativeError, *errors.RuntimeError, *ExitException, *ThrowException:
+		return err
+	}
+	return NewNativeError(err.Error())
+}
+
+// ToLox converts a Go value to the Lox value it is exposed as
+func ToLox(v interface{}) (LoxValue, error) {
+	switch v := v.(type) {
+	case nil, float64, string, bool:
+		return v, nil
+	case *LoxList, *LoxMap, *LoxInstance, *LoxClass, *LoxFunction, *NativeFunction, *LoxModule, *LoxError, *HostInstance:
+		return v, nil
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), nil
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Bool:
+		return value.Bool(), nil
+	case reflect.Func:
+		if value.IsNil() {
+			return nil, nil
+		}
+		return NewHostFunction("", v)
+	case reflect.Struct:
+		// copy the struct so that its fields can be set
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		return NewHostInstance(ptr.Interface())
+	case reflect.Pointer:
+		if value.IsNil() {
+			return nil, nil
+		}
+		if value.Elem().Kind() == reflect.Struct {
+			return NewHostInstance(v)
+		}
+		return ToLox(value.Elem().Interface())
+	case reflect.Interface:
+		if value.IsNil() {
+			return nil, nil
+		}
+		return ToLox(value.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil, nil
+		}
+		elements := make([]LoxValue, value.Len())
+		for j := range elements {
+			element, err := ToLox(value.Index(j).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[j] = element
+		}
+		return NewLoxList(elements), nil
+	case reflect.Map:
+		if value.IsNil() {
+			return nil, nil
+		}
+		m := NewLoxMap()
+		iter := value.MapRange()
+		for iter.Next() {
+			key, err := ToLox(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if !isHashable(key) {
+				return nil, fmt.Errorf("can't use %s as a map key", describeType(iter.Key().Type()))
+			}
+			element, err := ToLox(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			m.put(key, element)
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("can't convert a %T to a Lox value", v)
+}
+
+// Converts a value held in a Go struct, slice or array, which can be written
+// to, so that changes made to it by the program are seen by the Go code. A
+// value that is itself a copy, like an element of a map, is given writeBack
+// to store it again once it has changed.
+func hostView(v reflect.Value, writeBack func()) (LoxValue, error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		h, err := NewHostInstance(v.Addr().Interface())
+		if err != nil {
+			return nil, err
+		}
+		h.writeBack = writeBack
+		return h, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		elements := make([]LoxValue, v.Len())
+		for j := range elements {
+			element, err := hostView(v.Index(j), writeBack)
+			if err != nil {
+				return nil, err
+			}
+			elements[j] = element
+		}
+		list := NewLoxList(elements)
+		list.host, list.writeBack = v, writeBack
+		return list, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		m := NewLoxMap()
+		m.host = v
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := ToLox(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			if !isHashable(key) {
+				return nil, fmt.Errorf("can't use %s as a map key", describeType(iter.Key().Type()))
+			}
+
+			// map elements can't be changed in place, so each is copied and
+			// stored again whenever it changes
+			hostKey, element := iter.Key(), reflect.New(iter.Value().Type()).Elem()
+			element.Set(iter.Value())
+			value, err := hostView(element, func() {
+				v.SetMapIndex(hostKey, element)
+				if writeBack != nil {
+					writeBack()
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+			m.put(key, value)
+		}
+		return m, nil
+	}
+	return ToLox(v.Interface())
+}
+
+// FromLox converts a Lox value to the Go type t, reporting whether it could
+func FromLox(v LoxValue, t reflect.Type) (reflect.Value, bool) {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), true
+		}
+		return reflect.Value{}, false
+	}
+
+	value := reflect.ValueOf(v)
+	if value.Type().AssignableTo(t) {
+		return value, true
+	}
+
+	switch v := v.(type) {
+	case float64:
+		return numberFromLox(v, t)
+	case string:
+		if t.Kind() == reflect.String {
+			return value.Convert(t), true
+		}
+	case bool:
+		if t.Kind() == reflect.Bool {
+			return value.Convert(t), true
+		}
+	case *LoxList:
+		return listFromLox(v, t)
+	case *LoxMap:
+		return mapFromLox(v, t)
+	case *HostInstance:
+		if v.value.Type().AssignableTo(t) {
+			return v.value, true
+		}
+		if v.value.Elem().Type().AssignableTo(t) {
+			return v.value.Elem(), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func numberFromLox(n float64, t reflect.Type) (reflect.Value, bool) {
+	result := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 || result.OverflowInt(int64(n)) {
+			return reflect.Value{}, false
+		}
+		result.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n != math.Trunc(n) || n < 0 || n >= math.MaxUint64 || result.OverflowUint(uint64(n)) {
+			return reflect.Value{}, false
+		}
+		result.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		result.SetFloat(n)
+	default:
+		return reflect.Value{}, false
+	}
+	return result, true
+}
+
+func listFromLox(l *LoxList, t reflect.Type) (reflect.Value, bool) {
+	var result reflect.Value
+	switch t.Kind() {
+	case reflect.Slice:
+		result = reflect.MakeSlice(t, len(l.elements), len(l.elements))
+	case reflect.Array:
+		if t.Len() != len(l.elements) {
+			return reflect.Value{}, false
+		}
+		result = reflect.New(t).Elem()
+	default:
+		return reflect.Value{}, false
+	}
+
+	for j, element := range l.elements {
+		converted, ok := FromLox(element, t.Elem())
+		if !ok {
+			return reflect.Value{}, false
+		}
+		result.Index(j).Set(converted)
+	}
+	return result, true
+}
+
+func mapFromLox(m *LoxMap, t reflect.Type) (reflect.Value, bool) {
+	if t.Kind() != reflect.Map {
+		return reflect.Value{}, false
+	}
+
+	result := reflect.MakeMapWithSize(t, len(m.keys))
+	for _, key := range m.keys {
+		convertedKey, ok := FromLox(key, t.Key())
+		if !ok {
+			return reflect.Value{}, false
+		}
+		convertedValue, ok := FromLox(m.entries[key], t.Elem())
+		if !ok {
+			return reflect.Value{}, false
+		}
+		result.SetMapIndex(convertedKey, convertedValue)
+	}
+	return result, true
+}
+
+// Describes a Go type by the Lox values that convert to it, for error messages
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map:
+		return "a map"
+	case reflect.Struct:
+		return fmt.Sprintf("a %s instance", t.Name())
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Struct {
+			return fmt.Sprintf("a %s instance", t.Elem().Name())
+		}
+	}
+	return fmt.Sprintf("a %s", t)
+}
+
+// A HostInstance exposes a Go struct to Lox as an instance. Its exported fields
+// can be read and set, and its exported methods called. The name a member is
+// exposed under can be changed with a `lox:"name"` struct tag, and a tag of
+// `lox:"-"` hides a field.
+type HostInstance struct {
+	value   reflect.Value
+	fields  map[string]int
+	methods map[string]int
+	// writeBack stores the struct again after it changes, if it is a copy
+	writeBack func()
+}
+
+// NewHostInstance wraps a pointer to a struct. Changes made by the Lox program
+// are made to the struct itself.
+func NewHostInstance(ptr interface{}) (*HostInstance, error) {
+	value := reflect.ValueOf(ptr)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct || value.IsNil() {
+		return nil, fmt.Errorf("a %T is not a pointer to a struct", ptr)
+	}
+
+	structType := value.Elem().Type()
+	h := &HostInstance{
+		value:   value,
+		fields:  make(map[string]int),
+		methods: make(map[string]int),
+	}
+	for j := 0; j < structType.NumField(); j++ {
+		field := structType.Field(j)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("lox"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		h.fields[name] = j
+	}
+	// methods that can't be wrapped as native functions are left out
+	for j := 0; j < value.NumMethod(); j++ {
+		method := value.Type().Method(j)
+		if canReturn(method.Type) {
+			h.methods[method.Name] = j
+		}
+	}
+	return h, nil
+}
+
+// Value returns the pointer to the struct
+func (h *HostInstance) Value() interface{} {
+	return h.value.Interface()
+}
+
+func (h *HostInstance) String() string {
+	return fmt.Sprintf("%s instance", h.value.Elem().Type().Name())
+}
+
+func (h *HostInstance) Get(name token.Token) (LoxValue, error) {
+	if j, ok := h.fields[name.Lexeme]; ok {
+		value, err := hostView(h.value.Elem().Field(j), h.writeBack)
+		if err != nil {
+			return nil, errors.NewRuntimeError(name, err.Error())
+		}
+		return value, nil
+	}
+
+	if j, ok := h.methods[name.Lexeme]; ok {
+		typeName := h.value.Elem().Type().Name()
+		// only methods with supported results are listed, so this can't fail
+		method, _ := NewHostFunction(fmt.Sprintf("%s.%s", typeName, name.Lexeme), h.value.Method(j).Interface())
+		return method, nil
+	}
+
+	return nil, errors.NewRuntimeError(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme))
+}
+
+// Set assigns to a field. Unlike other instances, host instances can't be
+// given new fields.
+func (h *HostInstance) Set(name token.Token, value LoxValue) error {
+	j, ok := h.fields[name.Lexeme]
+	if !ok {
+		return errors.NewRuntimeError(name, fmt.Sprintf("Undefined field '%s'", name.Lexeme))
+	}
+
+	field := h.value.Elem().Field(j)
+	converted, ok := FromLox(value, field.Type())
+	if !ok {
+		return errors.NewRuntimeError(name, fmt.Sprintf("Field '%s' must be %s", name.Lexeme, describeType(field.Type())))
+	}
+	field.Set(converted)
+	if h.writeBack != nil {
+		h.writeBack()
+	}
+	return nil
+}
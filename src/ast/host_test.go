@@ -0,0 +1,256 @@
+package ast_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/glox"
+)
+
+type hostInner struct {
+	X int
+}
+
+type hostPoint struct {
+	Name   string
+	In     hostInner
+	Items  []int
+	Pair   [2]float64
+	Scores map[string]hostInner
+	Hidden int    `lox:"-"`
+	Label  string `lox:"label"`
+}
+
+func (p *hostPoint) Sum() int {
+	total := 0
+	for _, item := range p.Items {
+		total += item
+	}
+	return total
+}
+
+// runHost runs a program with the given globals bound, returning what it
+// printed
+func runHost(t *testing.T, source string, globals map[string]interface{}) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	l := glox.New(glox.WithStdout(&out))
+	for name, value := range globals {
+		if err := l.Bind(name, value); err != nil {
+			t.Fatalf("Bind(%s): %s", name, err)
+		}
+	}
+	err := l.Run(source, "test.lox")
+	return out.String(), err
+}
+
+func TestToLoxFromLoxRoundTrip(t *testing.T) {
+	values := []interface{}{
+		3, int8(-4), uint16(7), 2.5, float32(0.5), "text", true,
+		[]int{1, 2, 3}, [2]string{"a", "b"}, []string(nil),
+		map[string]int{"one": 1, "two": 2}, map[int]bool{1: true},
+	}
+	for _, value := range values {
+		converted, err := ast.ToLox(value)
+		if err != nil {
+			t.Errorf("ToLox(%#v): %s", value, err)
+			continue
+		}
+		back, ok := ast.FromLox(converted, reflect.TypeOf(value))
+		if !ok {
+			t.Errorf("FromLox(%s, %T) failed", ast.ToString(converted), value)
+			continue
+		}
+		if !reflect.DeepEqual(back.Interface(), value) {
+			t.Errorf("round trip of %#v gave %#v", value, back.Interface())
+		}
+	}
+}
+
+func TestToLoxStruct(t *testing.T) {
+	p := &hostPoint{Name: "p"}
+	converted, err := ast.ToLox(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance, ok := converted.(*ast.HostInstance)
+	if !ok {
+		t.Fatalf("ToLox(*hostPoint) = %T, want *ast.HostInstance", converted)
+	}
+	if instance.Value() != p {
+		t.Error("the instance doesn't wrap the original pointer")
+	}
+
+	back, ok := ast.FromLox(instance, reflect.TypeOf(hostPoint{}))
+	if !ok || back.Interface().(hostPoint).Name != "p" {
+		t.Errorf("FromLox(instance, hostPoint) = %v, %v", back, ok)
+	}
+}
+
+func TestToLoxUnsupported(t *testing.T) {
+	if _, err := ast.ToLox(make(chan int)); err == nil {
+		t.Error("ToLox(chan) should fail")
+	}
+	if _, err := ast.ToLox(map[[2]int]int{{1, 2}: 3}); err == nil {
+		t.Error("ToLox should reject map keys that aren't strings, numbers or booleans")
+	}
+}
+
+func TestFromLoxRejects(t *testing.T) {
+	cases := []struct {
+		value ast.LoxValue
+		t     reflect.Type
+	}{
+		{1.5, reflect.TypeOf(0)},
+		{-1.0, reflect.TypeOf(uint(0))},
+		{300.0, reflect.TypeOf(int8(0))},
+		{"1", reflect.TypeOf(0)},
+		{true, reflect.TypeOf("")},
+		{nil, reflect.TypeOf(0)},
+		{ast.NewLoxList([]ast.LoxValue{1.0, "two"}), reflect.TypeOf([]int{})},
+		{ast.NewLoxList([]ast.LoxValue{1.0}), reflect.TypeOf([2]int{})},
+	}
+	for _, c := range cases {
+		if _, ok := ast.FromLox(c.value, c.t); ok {
+			t.Errorf("FromLox(%s, %s) should fail", ast.ToString(c.value), c.t)
+		}
+	}
+}
+
+func TestHostFunctionCalls(t *testing.T) {
+	out, err := runHost(t, `
+print add(1, 2);
+print join("-", "a", "b", "c");
+print divide(6, 3);
+`, map[string]interface{}{
+		"add":  func(a, b int) int { return a + b },
+		"join": func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"divide": func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "3\na-b-c\n2\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestHostFunctionErrors(t *testing.T) {
+	globals := map[string]interface{}{
+		"add":     func(a, b int) int { return a + b },
+		"join":    func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"fail":    func() error { return fmt.Errorf("it failed") },
+		"explode": func() int { panic("boom") },
+	}
+	cases := []struct {
+		source  string
+		message string
+	}{
+		{"add(1);", "Expected 2 arguments but got 1"},
+		{"add(1, 2, 3);", "Expected 2 arguments but got 3"},
+		{"join();", "Expected at least 1 arguments but got 0"},
+		{`add(1, "2");`, "add() expects argument 2 to be an integer"},
+		{"add(1.5, 2);", "add() expects argument 1 to be an integer"},
+		{"join(1, 2);", "join() expects argument 1 to be a string"},
+		{"fail();", "it failed"},
+		{"explode();", "explode() panicked: boom"},
+	}
+	for _, c := range cases {
+		_, err := runHost(t, c.source, globals)
+		runtimeErr, ok := err.(*errors.RuntimeError)
+		if !ok {
+			t.Errorf("%s: got %v, want a runtime error", c.source, err)
+			continue
+		}
+		if runtimeErr.Message() != c.message {
+			t.Errorf("%s: got %q, want %q", c.source, runtimeErr.Message(), c.message)
+		}
+	}
+}
+
+func TestHostPanicCanBeCaught(t *testing.T) {
+	out, err := runHost(t, `
+try {
+  explode();
+} catch (e) {
+  print e.message;
+}
+`, map[string]interface{}{"explode": func() { panic("boom") }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "explode() panicked: boom\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestHostInstanceFields(t *testing.T) {
+	p := &hostPoint{Name: "a", Items: []int{1, 2, 3}}
+	out, err := runHost(t, `
+print p.Name;
+p.Name = "b";
+p.label = "tagged";
+print p.Sum();
+`, map[string]interface{}{"p": p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "a\n6\n" {
+		t.Errorf("output = %q", out)
+	}
+	if p.Name != "b" || p.Label != "tagged" {
+		t.Errorf("fields weren't set: %+v", p)
+	}
+
+	for _, source := range []string{"p.Hidden;", "p.Label;", "p.Missing = 1;", `p.Name = 1;`} {
+		if _, err := runHost(t, source, map[string]interface{}{"p": p}); err == nil {
+			t.Errorf("%s should fail", source)
+		}
+	}
+}
+
+func TestHostInstanceWritesThrough(t *testing.T) {
+	p := &hostPoint{Items: []int{1, 2}, Scores: map[string]hostInner{"a": {1}}}
+	out, err := runHost(t, `
+p.In.X = 5;
+print p.In.X;
+p.Items[0] = 9;
+print p.Items;
+p.Pair[1] = 0.5;
+p.Scores["a"].X = 7;
+p.Scores["b"] = p.In;
+var inner = p.In;
+inner.X = 6;
+`, map[string]interface{}{"p": p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "5\n[9, 2]\n" {
+		t.Errorf("output = %q", out)
+	}
+
+	want := &hostPoint{
+		In:     hostInner{6},
+		Items:  []int{9, 2},
+		Pair:   [2]float64{0, 0.5},
+		Scores: map[string]hostInner{"a": {7}, "b": {5}},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+
+	_, err = runHost(t, `p.Items[0] = "nine";`, map[string]interface{}{"p": p})
+	if runtimeErr, ok := err.(*errors.RuntimeError); !ok || runtimeErr.Message() != "List element must be an integer" {
+		t.Errorf("assigning a string to an []int element: got %v", err)
+	}
+}
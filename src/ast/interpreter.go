@@ -1,37 +1,150 @@
 package ast
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/faideww/glox/src/errors"
 	"github.com/faideww/glox/src/token"
 )
 
 type Interpreter struct {
+	builtins   *Environment
 	globals    *Environment
 	currentEnv *Environment
-	locals     map[Expr]int
+	locals     map[token.Token]int
+	module     *LoxModule
+	mainModule *LoxModule
+	modules    map[string]*LoxModule
+	loading    []string
+	loader     ModuleLoader
+	namespaces []string
+	args       []string
+	random     *rand.Rand
+	stdin      *bufio.Reader
+	stdout     io.Writer
+	frames     []errors.StackFrame
+	// where each frame was called from, for the debugger
+	callers      []caller
+	dynamicScope bool
+	maxDepth     int
+	limits       Limits
+	usage        usage
+	debugger     *Debugger
+	profiler     *Profiler
 }
 
-func NewInterpreter() *Interpreter {
-	globalEnv := NewGlobalEnvironment()
+// DEFAULT_MAX_CALL_DEPTH is deep enough for any reasonable recursion while
+// staying well clear of the Go runtime's own stack limit
+const DEFAULT_MAX_CALL_DEPTH = 1000
 
-	globalEnv.Define("clock", NewNativeFunction(
+type InterpreterOption func(i *Interpreter)
+
+// WithNamespaces limits the standard library to the given namespaces. By
+// default every registered namespace is enabled.
+func WithNamespaces(names ...string) InterpreterOption {
+	return func(i *Interpreter) {
+		i.namespaces = names
+	}
+}
+
+// WithArgs sets the arguments returned by os.args()
+func WithArgs(args []string) InterpreterOption {
+	return func(i *Interpreter) {
+		i.args = args
+	}
+}
+
+// WithMaxCallDepth limits how deeply calls may nest before the interpreter
+// raises a "Stack overflow" runtime error
+func WithMaxCallDepth(depth int) InterpreterOption {
+	return func(i *Interpreter) {
+		i.maxDepth = depth
+	}
+}
+
+// WithStdout sends the output of print statements to w instead of os.Stdout
+func WithStdout(w io.Writer) InterpreterOption {
+	return func(i *Interpreter) {
+		i.stdout = w
+	}
+}
+
+// WithStdin reads the input for io.readLine() from r instead of os.Stdin. A
+// *bufio.Reader is used as it is, so the host can keep reading from it too.
+func WithStdin(r io.Reader) InterpreterOption {
+	return func(i *Interpreter) {
+		i.stdin = bufio.NewReader(r)
+	}
+}
+
+func NewInterpreter(options ...InterpreterOption) *Interpreter {
+	builtins := NewGlobalEnvironment()
+
+	defineNative(&builtins, "clock", NewNativeFunction(
 		func() int { return 0 },
 		func(args []LoxValue, _ *Interpreter) (LoxValue, error) {
 			return float64(time.Now().Unix()), nil
 		},
 	))
+	defineCollectionNatives(&builtins)
 
-	return &Interpreter{
-		globals:    &globalEnv,
-		currentEnv: &globalEnv,
-		locals:     make(map[Expr]int),
+	main := NewLoxModule("", &builtins)
+	i := &Interpreter{
+		builtins:   &builtins,
+		currentEnv: main.globals,
+		mainModule: main,
+		modules:    make(map[string]*LoxModule),
+		loading:    []string{main.path},
+		namespaces: RegisteredNamespaces(),
+		args:       make([]string, 0),
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		maxDepth:   DEFAULT_MAX_CALL_DEPTH,
+		stdin:      bufio.NewReader(os.Stdin),
+		stdout:     os.Stdout,
+	}
+	for _, option := range options {
+		option(i)
 	}
+	defineNamespaces(&builtins, i.namespaces)
+
+	i.enterModule(main)
+	return i
+}
+
+// SetModuleLoader enables import statements. Imports are resolved relative to
+// the directory of mainPath, the file being run.
+func (i *Interpreter) SetModuleLoader(mainPath string, loader ModuleLoader) {
+	i.module.path = filepath.Clean(mainPath)
+	i.loading[0] = i.module.path
+	i.loader = loader
 }
 
-func (i *Interpreter) Interpret(statements []Stmt) error {
+// Interpret runs a program. Cancelling ctx stops it with an "Interrupted"
+// runtime error. The limits set with WithLimits apply to each call separately,
+// so the interpreter can be used again after a LimitError.
+func (i *Interpreter) Interpret(ctx context.Context, statements []Stmt) error {
+	end := i.beginRun(ctx)
+	defer end()
+	return i.executeAll(statements)
+}
+
+func (i *Interpreter) InterpretExpression(ctx context.Context, expression Expr) (LoxValue, error) {
+	end := i.beginRun(ctx)
+	defer end()
+	return expression.(Evaluable).Evaluate(i)
+}
+
+func (i *Interpreter) executeAll(statements []Stmt) error {
 	for _, statement := range statements {
-		err := statement.(EvaluableStmt).Evaluate(i)
+		err := i.execute(statement)
 		if err != nil {
 			return err
 		}
@@ -40,20 +153,181 @@ func (i *Interpreter) Interpret(statements []Stmt) error {
 	return nil
 }
 
-func (i *Interpreter) InterpretExpression(expression Expr) (LoxValue, error) {
-	return expression.(Evaluable).Evaluate(i)
+// execute runs a single statement. Every statement goes through here, so that
+// cancellation and the step and time limits are checked between them, so that
+// the debugger can pause before it, and so that the profiler can time it.
+func (i *Interpreter) execute(stmt Stmt) error {
+	if i.usage.exceeded != nil {
+		return i.usage.exceeded
+	}
+
+	i.usage.steps++
+	if i.limits.MaxSteps > 0 && i.usage.steps > i.limits.MaxSteps {
+		return i.exceed(LIMIT_STEPS, stmtToken(stmt))
+	}
+	err := i.checkInterrupted(stmtToken(stmt))
+	if err != nil {
+		return err
+	}
 
+	if i.debugger != nil {
+		err = i.debugger.before(i, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if i.profiler != nil {
+		i.profiler.statement(stmtToken(stmt))
+	}
+
+	return stmt.(EvaluableStmt).Evaluate(i)
 }
-func (i *Interpreter) resolve(expr Expr, depth int) {
-	i.locals[expr] = depth
+
+// Global returns the value of a global variable in the main module, or of a
+// native function
+func (i *Interpreter) Global(name string) (LoxValue, bool) {
+	return i.mainModule.globals.Lookup(name)
+}
+
+// DefineGlobal defines (or redefines) a global variable in the main module
+func (i *Interpreter) DefineGlobal(name string, value LoxValue) {
+	i.mainModule.globals.Define(name, value)
 }
 
-func (i *Interpreter) lookupVariable(name token.Token, expr Expr) (LoxValue, error) {
-	// fmt.Printf("%#v:%d\n", name, i.locals[expr])
-	if hops, ok := i.locals[expr]; ok {
+func (i *Interpreter) resolve(name token.Token, depth int) {
+	i.locals[name] = depth
+}
+
+func (i *Interpreter) lookupVariable(name token.Token) (LoxValue, error) {
+	// fmt.Printf("%#v:%d\n", name, i.locals[name])
+	if hops, ok := i.locals[name]; ok {
 		// If the resolver has been run, this is guaranteed to find a value
 		return i.currentEnv.GetAt(hops, name.Lexeme), nil
+	} else if i.dynamicScope {
+		return i.currentEnv.Get(name)
 	} else {
 		return i.globals.Get(name)
 	}
 }
+
+// MaxCallDepth returns the deepest that calls may nest
+func (i *Interpreter) MaxCallDepth() int {
+	return i.maxDepth
+}
+
+func (i *Interpreter) SetMaxCallDepth(depth int) {
+	i.maxDepth = depth
+}
+
+// Pushes a new call frame, or fails with a stack overflow error reported at
+// site if the call depth limit has been reached
+func (i *Interpreter) pushFrame(frame errors.StackFrame, site token.Token) error {
+	if len(i.frames) >= i.maxDepth {
+		return errors.NewRuntimeError(site, "Stack overflow")
+	}
+	i.frames = append(i.frames, frame)
+	i.callers = append(i.callers, caller{i.currentEnv, site})
+	return nil
+}
+
+func (i *Interpreter) popFrame() {
+	i.frames = i.frames[:len(i.frames)-1]
+	i.callers = i.callers[:len(i.callers)-1]
+}
+
+// A caller is the state of the frame that made a call: the environment it was
+// executing in and the call site
+type caller struct {
+	env  *Environment
+	site token.Token
+}
+
+// Returns a copy of the current call stack, outermost call first
+func (i *Interpreter) stackTrace() []errors.StackFrame {
+	trace := make([]errors.StackFrame, len(i.frames))
+	copy(trace, i.frames)
+	return trace
+}
+
+// Records the current call stack on a runtime error that doesn't have one yet.
+// Since this is done at every frame boundary, the first frame to see the error
+// is the one it was raised in.
+func (i *Interpreter) attachTrace(err error) {
+	if runtimeErr, ok := err.(*errors.RuntimeError); ok && runtimeErr.Trace() == nil {
+		runtimeErr.SetTrace(i.stackTrace())
+	}
+}
+
+// Switches global and local variable resolution over to the given module,
+// returning the previously active module so that it can be restored
+func (i *Interpreter) enterModule(module *LoxModule) *LoxModule {
+	prev := i.module
+	i.module = module
+	i.globals = module.globals
+	i.locals = module.locals
+	return prev
+}
+
+// Loads and executes the module at importPath (relative to the current
+// module's file), or returns the cached module if it has already been run
+func (i *Interpreter) importModule(keyword token.Token, importPath string) (*LoxModule, error) {
+	path := importPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(i.module.path), path)
+	}
+	path = filepath.Clean(path)
+
+	if module, ok := i.modules[path]; ok {
+		return module, nil
+	}
+
+	for j, loading := range i.loading {
+		if loading == path {
+			cycle := strings.Join(append(i.loading[j:], path), " -> ")
+			return nil, errors.NewRuntimeError(keyword, fmt.Sprintf("Import cycle detected: %s", cycle))
+		}
+	}
+
+	if i.loader == nil {
+		return nil, errors.NewRuntimeError(keyword, "Imports are not supported here")
+	}
+
+	module := NewLoxModule(path, i.builtins)
+	prevModule := i.enterModule(module)
+	prevEnv := i.currentEnv
+	i.loading = append(i.loading, path)
+	defer func() {
+		i.loading = i.loading[:len(i.loading)-1]
+		i.currentEnv = prevEnv
+		i.enterModule(prevModule)
+	}()
+
+	statements, err := i.loader(path)
+	if err != nil {
+		return nil, errors.NewRuntimeError(keyword, fmt.Sprintf("Can't import '%s': %s", importPath, strings.TrimSpace(err.Error())))
+	}
+
+	// a module's top-level code shows up in stack traces as a call made by the
+	// import statement
+	err = i.pushFrame(errors.StackFrame{Function: module.String(), Line: keyword.Line}, keyword)
+	if err != nil {
+		return nil, err
+	}
+	i.currentEnv = module.globals
+	if i.profiler != nil {
+		i.profiler.enter(i.frames[len(i.frames)-1], PROFILE_MODULE)
+	}
+	err = i.executeAll(statements)
+	if i.profiler != nil {
+		i.profiler.exit()
+	}
+	i.attachTrace(err)
+	i.popFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	i.modules[path] = module
+	return module, nil
+}
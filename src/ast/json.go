@@ -0,0 +1,339 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/faideww/glox/src/token"
+)
+
+// Every node marshals to a JSON object whose "type" is the name of the node,
+// with names written as strings and child nodes nested inside. Nodes that
+// keep a token of their own also record the line it's on.
+
+func (bs BlockStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type       string `json:"type"`
+		Line       int    `json:"line,omitempty"`
+		Statements []Stmt `json:"statements"`
+	}{"BlockStmt", bs.brace.Line, bs.statements})
+}
+
+func (bs BreakStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type string `json:"type"`
+		Line int    `json:"line"`
+	}{"BreakStmt", bs.token.Line})
+}
+
+func (cs ClassStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type       string         `json:"type"`
+		Line       int            `json:"line"`
+		Name       string         `json:"name"`
+		Superclass *VariableExpr  `json:"superclass"`
+		Methods    []FunctionStmt `json:"methods"`
+	}{"ClassStmt", cs.name.Line, cs.name.Lexeme, cs.superclass, cs.methods})
+}
+
+func (cs ContinueStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type string `json:"type"`
+		Line int    `json:"line"`
+	}{"ContinueStmt", cs.token.Line})
+}
+
+func (es ExpressionStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type       string `json:"type"`
+		Expression Expr   `json:"expression"`
+	}{"ExpressionStmt", es.expression})
+}
+
+// for loops include the while loop they are desugared into, which is what
+// actually runs
+func (fs ForStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type        string `json:"type"`
+		Line        int    `json:"line"`
+		Initializer Stmt   `json:"initializer"`
+		Condition   Expr   `json:"condition"`
+		Increment   Expr   `json:"increment"`
+		Body        Stmt   `json:"body"`
+		Desugared   Stmt   `json:"desugared"`
+	}{"ForStmt", fs.keyword.Line, fs.initializer, fs.condition, fs.increment, fs.body, fs.loop})
+}
+
+func (fs FunctionStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type   string   `json:"type"`
+		Line   int      `json:"line"`
+		Name   string   `json:"name"`
+		Params []string `json:"params"`
+		Body   []Stmt   `json:"body"`
+	}{"FunctionStmt", fs.name.Line, fs.name.Lexeme, lexemes(fs.params), fs.body})
+}
+
+func (is IfStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type       string `json:"type"`
+		Line       int    `json:"line"`
+		Condition  Expr   `json:"condition"`
+		ThenBranch Stmt   `json:"then"`
+		ElseBranch Stmt   `json:"else"`
+	}{"IfStmt", is.keyword.Line, is.condition, is.thenBranch, is.elseBranch})
+}
+
+func (is ImportStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type string `json:"type"`
+		Line int    `json:"line"`
+		Path string `json:"path"`
+		Name string `json:"name"`
+	}{"ImportStmt", is.keyword.Line, is.path.Literal.(string), is.name.Lexeme})
+}
+
+func (ps PrintStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type       string `json:"type"`
+		Line       int    `json:"line"`
+		Expression Expr   `json:"expression"`
+	}{"PrintStmt", ps.keyword.Line, ps.expression})
+}
+
+func (rs ReturnStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type  string `json:"type"`
+		Line  int    `json:"line"`
+		Value Expr   `json:"value"`
+	}{"ReturnStmt", rs.keyword.Line, rs.value})
+}
+
+func (ts ThrowStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type  string `json:"type"`
+		Line  int    `json:"line"`
+		Value Expr   `json:"value"`
+	}{"ThrowStmt", ts.keyword.Line, ts.value})
+}
+
+func (ts TryStmt) MarshalJSON() ([]byte, error) {
+	var catchParam *string
+	if ts.catchBlock != nil {
+		catchParam = &ts.catchParam.Lexeme
+	}
+	return marshal(struct {
+		Type         string     `json:"type"`
+		Line         int        `json:"line"`
+		Body         BlockStmt  `json:"body"`
+		CatchParam   *string    `json:"catchParam"`
+		CatchBlock   *BlockStmt `json:"catch"`
+		FinallyBlock *BlockStmt `json:"finally"`
+	}{"TryStmt", ts.keyword.Line, ts.body, catchParam, ts.catchBlock, ts.finallyBlock})
+}
+
+func (vs VarStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type        string `json:"type"`
+		Line        int    `json:"line"`
+		Name        string `json:"name"`
+		Initializer Expr   `json:"initializer"`
+	}{"VarStmt", vs.keyword.Line, vs.name.Lexeme, vs.initializer})
+}
+
+func (ws WhileStmt) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type      string `json:"type"`
+		Line      int    `json:"line"`
+		Condition Expr   `json:"condition"`
+		Body      Stmt   `json:"body"`
+		Increment Stmt   `json:"increment,omitempty"`
+	}{"WhileStmt", ws.keyword.Line, ws.condition, ws.body, ws.increment})
+}
+
+func (a AssignmentExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type  string `json:"type"`
+		Line  int    `json:"line"`
+		Name  string `json:"name"`
+		Value Expr   `json:"value"`
+	}{"AssignmentExpr", a.name.Line, a.name.Lexeme, a.value})
+}
+
+func (b BinaryExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type     string `json:"type"`
+		Line     int    `json:"line"`
+		Operator string `json:"operator"`
+		Left     Expr   `json:"left"`
+		Right    Expr   `json:"right"`
+	}{"BinaryExpr", b.operator.Line, b.operator.Lexeme, b.left, b.right})
+}
+
+func (c CallExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type      string `json:"type"`
+		Line      int    `json:"line"`
+		Callee    Expr   `json:"callee"`
+		Arguments []Expr `json:"arguments"`
+	}{"CallExpr", c.paren.Line, c.callee, c.arguments})
+}
+
+func (f FunctionExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type   string   `json:"type"`
+		Line   int      `json:"line"`
+		Params []string `json:"params"`
+		Body   []Stmt   `json:"body"`
+	}{"FunctionExpr", f.keyword.Line, lexemes(f.params), f.body})
+}
+
+func (g GetExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type   string `json:"type"`
+		Line   int    `json:"line"`
+		Object Expr   `json:"object"`
+		Name   string `json:"name"`
+	}{"GetExpr", g.name.Line, g.object, g.name.Lexeme})
+}
+
+func (g GroupingExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type       string `json:"type"`
+		Line       int    `json:"line,omitempty"`
+		Expression Expr   `json:"expression"`
+	}{"GroupingExpr", g.paren.Line, g.expression})
+}
+
+func (ie IndexExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type   string `json:"type"`
+		Line   int    `json:"line"`
+		Object Expr   `json:"object"`
+		Index  Expr   `json:"index"`
+	}{"IndexExpr", ie.bracket.Line, ie.object, ie.index})
+}
+
+func (is IndexSetExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type   string `json:"type"`
+		Line   int    `json:"line"`
+		Object Expr   `json:"object"`
+		Index  Expr   `json:"index"`
+		Value  Expr   `json:"value"`
+	}{"IndexSetExpr", is.bracket.Line, is.object, is.index, is.value})
+}
+
+func (l ListExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type     string `json:"type"`
+		Line     int    `json:"line"`
+		Elements []Expr `json:"elements"`
+	}{"ListExpr", l.bracket.Line, l.elements})
+}
+
+func (l LiteralExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type  string   `json:"type"`
+		Line  int      `json:"line,omitempty"`
+		Value LoxValue `json:"value"`
+	}{"LiteralExpr", l.token.Line, l.value})
+}
+
+func (l LogicalExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type     string `json:"type"`
+		Line     int    `json:"line"`
+		Operator string `json:"operator"`
+		Left     Expr   `json:"left"`
+		Right    Expr   `json:"right"`
+	}{"LogicalExpr", l.operator.Line, l.operator.Lexeme, l.left, l.right})
+}
+
+func (m MapExpr) MarshalJSON() ([]byte, error) {
+	type entry struct {
+		Key   Expr `json:"key"`
+		Value Expr `json:"value"`
+	}
+	entries := make([]entry, len(m.keys))
+	for i, key := range m.keys {
+		entries[i] = entry{key, m.values[i]}
+	}
+	return marshal(struct {
+		Type    string  `json:"type"`
+		Line    int     `json:"line"`
+		Entries []entry `json:"entries"`
+	}{"MapExpr", m.brace.Line, entries})
+}
+
+func (s SetExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type   string `json:"type"`
+		Line   int    `json:"line"`
+		Object Expr   `json:"object"`
+		Name   string `json:"name"`
+		Value  Expr   `json:"value"`
+	}{"SetExpr", s.name.Line, s.obj, s.name.Lexeme, s.value})
+}
+
+func (s SuperExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type   string `json:"type"`
+		Line   int    `json:"line"`
+		Method string `json:"method"`
+	}{"SuperExpr", s.keyword.Line, s.method.Lexeme})
+}
+
+func (t TernaryExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type      string `json:"type"`
+		Condition Expr   `json:"condition"`
+		Left      Expr   `json:"left"`
+		Right     Expr   `json:"right"`
+	}{"TernaryExpr", t.condition, t.left, t.right})
+}
+
+func (t ThisExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type string `json:"type"`
+		Line int    `json:"line"`
+	}{"ThisExpr", t.keyword.Line})
+}
+
+func (u UnaryExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type     string `json:"type"`
+		Line     int    `json:"line"`
+		Operator string `json:"operator"`
+		Right    Expr   `json:"right"`
+	}{"UnaryExpr", u.operator.Line, u.operator.Lexeme, u.right})
+}
+
+func (v VariableExpr) MarshalJSON() ([]byte, error) {
+	return marshal(struct {
+		Type string `json:"type"`
+		Line int    `json:"line"`
+		Name string `json:"name"`
+	}{"VariableExpr", v.name.Line, v.name.Lexeme})
+}
+
+func lexemes(tokens []token.Token) []string {
+	names := make([]string, len(tokens))
+	for i, t := range tokens {
+		names[i] = t.Lexeme
+	}
+	return names
+}
+
+// marshal is json.Marshal without the escaping of HTML characters, which would
+// make operators like "<" unreadable
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,57 @@
+package ast
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+func ioNamespace() map[string]*NativeFunction {
+	return map[string]*NativeFunction{
+		"readLine":  NewNativeFunction(fixedArity(0), ioReadLine),
+		"readFile":  NewNativeFunction(fixedArity(1), ioReadFile),
+		"writeFile": NewNativeFunction(fixedArity(2), ioWriteFile),
+	}
+}
+
+// Returns the next line of standard input without its line ending, or nil
+// once the input is exhausted
+func ioReadLine(_ []LoxValue, i *Interpreter) (LoxValue, error) {
+	line, err := i.stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil, nil
+	} else if err != nil && err != io.EOF {
+		return nil, NewNativeError(err.Error())
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func ioReadFile(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	path, err := stringArg("io.readFile", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewNativeError(err.Error())
+	}
+	return string(bytes), nil
+}
+
+func ioWriteFile(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	path, err := stringArg("io.writeFile", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := stringArg("io.writeFile", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, []byte(contents), 0644)
+	if err != nil {
+		return nil, NewNativeError(err.Error())
+	}
+	return nil, nil
+}
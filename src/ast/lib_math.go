@@ -0,0 +1,53 @@
+package ast
+
+import (
+	"math"
+)
+
+func mathNamespace() map[string]*NativeFunction {
+	return map[string]*NativeFunction{
+		"sqrt":   NewNativeFunction(fixedArity(1), mathUnary("math.sqrt", math.Sqrt)),
+		"floor":  NewNativeFunction(fixedArity(1), mathUnary("math.floor", math.Floor)),
+		"pow":    NewNativeFunction(fixedArity(2), mathPow),
+		"random": NewNativeFunction(fixedArity(0), mathRandom),
+		"seed":   NewNativeFunction(fixedArity(1), mathSeed),
+	}
+}
+
+func mathUnary(name string, fn func(float64) float64) callFn {
+	return func(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+		n, err := numberArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return fn(n), nil
+	}
+}
+
+func mathPow(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	base, err := numberArg("math.pow", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	exponent, err := numberArg("math.pow", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+// Returns a pseudo-random number in [0, 1) from the interpreter's generator
+func mathRandom(_ []LoxValue, i *Interpreter) (LoxValue, error) {
+	return i.random.Float64(), nil
+}
+
+// Reseeds the interpreter's generator, so that the sequence of math.random()
+// results is reproducible
+func mathSeed(args []LoxValue, i *Interpreter) (LoxValue, error) {
+	seed, err := numberArg("math.seed", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i.random.Seed(int64(seed))
+	return nil, nil
+}
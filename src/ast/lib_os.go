@@ -0,0 +1,50 @@
+package ast
+
+import (
+	"math"
+	"os"
+)
+
+func osNamespace() map[string]*NativeFunction {
+	return map[string]*NativeFunction{
+		"args": NewNativeFunction(fixedArity(0), osArgs),
+		"env":  NewNativeFunction(fixedArity(1), osEnv),
+		"exit": NewNativeFunction(fixedArity(1), osExit),
+	}
+}
+
+// Returns the arguments passed to the script, not including the script itself
+func osArgs(_ []LoxValue, i *Interpreter) (LoxValue, error) {
+	elements := make([]LoxValue, len(i.args))
+	for j, arg := range i.args {
+		elements[j] = arg
+	}
+	return NewLoxList(elements), nil
+}
+
+// Returns the value of the environment variable, or nil if it isn't set
+func osEnv(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	name, err := stringArg("os.env", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// Stops the program. Rather than exiting the process directly, this unwinds
+// the interpreter with an ExitException so that the host decides what to do.
+func osExit(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	code, err := numberArg("os.exit", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if code != math.Trunc(code) {
+		return nil, NewNativeError("os.exit() expects an integer exit code")
+	}
+	return nil, NewExitException(int(code))
+}
@@ -0,0 +1,159 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+func strNamespace() map[string]*NativeFunction {
+	return map[string]*NativeFunction{
+		"len":       NewNativeFunction(fixedArity(1), strLen),
+		"substring": NewNativeFunction(fixedArity(3), strSubstring),
+		"split":     NewNativeFunction(fixedArity(2), strSplit),
+		"join":      NewNativeFunction(fixedArity(2), strJoin),
+		"upper":     NewNativeFunction(fixedArity(1), strMap("str.upper", strings.ToUpper)),
+		"lower":     NewNativeFunction(fixedArity(1), strMap("str.lower", strings.ToLower)),
+		"indexOf":   NewNativeFunction(fixedArity(2), strIndexOf),
+		"replace":   NewNativeFunction(fixedArity(3), strReplace),
+		"format":    NewNativeFunction(fixedArity(VARIADIC), strFormat),
+	}
+}
+
+// Strings are indexed by character rather than by byte, matching len()
+func strLen(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	s, err := stringArg("str.len", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return float64(utf8.RuneCountInString(s)), nil
+}
+
+func strSubstring(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	s, err := stringArg("str.substring", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, err := numberArg("str.substring", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	end, err := numberArg("str.substring", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	runes := []rune(s)
+	if start != math.Trunc(start) || end != math.Trunc(end) ||
+		start < 0 || end > float64(len(runes)) || start > end {
+		return nil, NewNativeError(fmt.Sprintf("str.substring() range [%s, %s) is out of bounds", ToString(start), ToString(end)))
+	}
+	return string(runes[int(start):int(end)]), nil
+}
+
+func strSplit(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	s, err := stringArg("str.split", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sep, err := stringArg("str.split", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(s, sep)
+	elements := make([]LoxValue, len(parts))
+	for j, part := range parts {
+		elements[j] = part
+	}
+	return NewLoxList(elements), nil
+}
+
+func strJoin(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	list, ok := args[0].(*LoxList)
+	if !ok {
+		return nil, NewNativeError("str.join() expects argument 1 to be a list")
+	}
+	sep, err := stringArg("str.join", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]string, len(list.elements))
+	for j, element := range list.elements {
+		parts[j] = ToString(element)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func strMap(name string, fn func(string) string) callFn {
+	return func(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+		s, err := stringArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return fn(s), nil
+	}
+}
+
+// Returns the character index of the first occurrence of the substring, or
+// -1 if it isn't present
+func strIndexOf(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	s, err := stringArg("str.indexOf", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := stringArg("str.indexOf", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	byteIndex := strings.Index(s, sub)
+	if byteIndex < 0 {
+		return float64(-1), nil
+	}
+	return float64(utf8.RuneCountInString(s[:byteIndex])), nil
+}
+
+func strReplace(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	s, err := stringArg("str.replace", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	old, err := stringArg("str.replace", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := stringArg("str.replace", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ReplaceAll(s, old, replacement), nil
+}
+
+// Replaces each "{}" in the template with the next argument, in order
+func strFormat(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	if len(args) == 0 {
+		return nil, NewNativeError("str.format() expects a template string")
+	}
+	template, err := stringArg("str.format", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	values := args[1:]
+	pieces := strings.Split(template, "{}")
+	if len(pieces)-1 != len(values) {
+		return nil, NewNativeError(fmt.Sprintf("str.format() template has %d placeholders but got %d values", len(pieces)-1, len(values)))
+	}
+
+	var sb strings.Builder
+	for j, piece := range pieces {
+		sb.WriteString(piece)
+		if j < len(values) {
+			sb.WriteString(ToString(values[j]))
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,217 @@
+package ast
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+)
+
+// Limits bounds the work a single call to Interpret or InterpretExpression may
+// do, so that untrusted programs can be run safely. A zero field means no
+// limit.
+type Limits struct {
+	// MaxSteps is the number of statements that may be executed, counting
+	// each iteration of a loop body and each statement of a function call
+	MaxSteps int
+	// Timeout is how long the program may run for
+	Timeout time.Duration
+	// MaxInstances is the number of class instances, lists and maps that may
+	// be created
+	MaxInstances int
+	// MaxStringBytes is the total length of the strings that may be built,
+	// by concatenation or by native functions
+	MaxStringBytes int
+	// MaxElements is the number of list elements and map entries that may be
+	// created, counting every new key added to a map
+	MaxElements int
+}
+
+type Limit int
+
+const (
+	LIMIT_STEPS Limit = iota
+	LIMIT_TIME
+	LIMIT_INSTANCES
+	LIMIT_STRINGS
+	LIMIT_ELEMENTS
+)
+
+var limitMessages = map[Limit]string{
+	LIMIT_STEPS:     "Step limit exceeded",
+	LIMIT_TIME:      "Time limit exceeded",
+	LIMIT_INSTANCES: "Instance limit exceeded",
+	LIMIT_STRINGS:   "String memory limit exceeded",
+	LIMIT_ELEMENTS:  "Element limit exceeded",
+}
+
+// WithLimits bounds the resources programs may use. Exceeding a limit stops the
+// program with a LimitError.
+func WithLimits(limits Limits) InterpreterOption {
+	return func(i *Interpreter) {
+		i.limits = limits
+	}
+}
+
+// LimitError stops a program that has exceeded one of the interpreter's limits.
+// Unlike a runtime error it can't be caught by the program itself, only by the
+// host that is running it.
+type LimitError struct {
+	limit Limit
+	err   *errors.RuntimeError
+}
+
+func (e *LimitError) Error() string {
+	return e.err.Error()
+}
+
+// Limit returns which limit was exceeded
+func (e *LimitError) Limit() Limit {
+	return e.limit
+}
+
+// RuntimeError describes the limit being exceeded as a runtime error raised
+// where the program was stopped
+func (e *LimitError) RuntimeError() *errors.RuntimeError {
+	return e.err
+}
+
+func NewLimitError(limit Limit, site token.Token) *LimitError {
+	return &LimitError{limit, errors.NewRuntimeError(site, limitMessages[limit])}
+}
+
+// usage counts what the current run has used against its limits
+type usage struct {
+	steps       int
+	instances   int
+	stringBytes int
+	elements    int
+	// ctx is the context the run was started with, and deadline is ctx with
+	// the time limit applied
+	ctx      context.Context
+	deadline context.Context
+	// once a limit has been exceeded, every later check fails too, so that
+	// finally blocks can't keep the program going
+	exceeded *LimitError
+	// the same goes for the "Interrupted" error raised once ctx is cancelled,
+	// which catch clauses also let through
+	interrupted *errors.RuntimeError
+}
+
+// Starts counting usage afresh for a new run, and starts the profiler's clock,
+// returning a function that ends it
+func (i *Interpreter) beginRun(ctx context.Context) func() {
+	i.usage = usage{ctx: ctx, deadline: ctx}
+	cancel := func() {}
+	if i.limits.Timeout > 0 {
+		i.usage.deadline, cancel = context.WithTimeout(ctx, i.limits.Timeout)
+	}
+	if i.profiler == nil {
+		return cancel
+	}
+
+	i.profiler.start()
+	return func() {
+		cancel()
+		i.profiler.stop()
+	}
+}
+
+// Fails with an "Interrupted" runtime error at site if the run's context has
+// been cancelled, or with a LimitError if it has run out of time
+func (i *Interpreter) checkInterrupted(site token.Token) error {
+	if i.usage.ctx == nil || i.usage.deadline.Err() == nil {
+		return nil
+	}
+	if i.usage.ctx.Err() == nil {
+		return i.exceed(LIMIT_TIME, site)
+	}
+
+	if i.usage.interrupted == nil {
+		i.usage.interrupted = errors.NewRuntimeError(site, "Interrupted")
+		i.usage.interrupted.SetTrace(i.stackTrace())
+	}
+	return i.usage.interrupted
+}
+
+// Reports whether err stopped the program because its context was cancelled
+func (i *Interpreter) isInterrupted(err error) bool {
+	return i.usage.interrupted != nil && err == error(i.usage.interrupted)
+}
+
+// Fails with a LimitError, recording the current call stack on it
+func (i *Interpreter) exceed(limit Limit, site token.Token) error {
+	if i.usage.exceeded == nil {
+		i.usage.exceeded = NewLimitError(limit, site)
+		i.usage.exceeded.err.SetTrace(i.stackTrace())
+	}
+	return i.usage.exceeded
+}
+
+// Counts a newly created instance, list or map
+func (i *Interpreter) allocateInstance(site token.Token) error {
+	i.usage.instances++
+	if i.limits.MaxInstances > 0 && i.usage.instances > i.limits.MaxInstances {
+		return i.exceed(LIMIT_INSTANCES, site)
+	}
+	return nil
+}
+
+// Counts a newly built string
+func (i *Interpreter) allocateString(site token.Token, s string) error {
+	i.usage.stringBytes += len(s)
+	if i.limits.MaxStringBytes > 0 && i.usage.stringBytes > i.limits.MaxStringBytes {
+		return i.exceed(LIMIT_STRINGS, site)
+	}
+	return nil
+}
+
+// Counts new list elements or map entries
+func (i *Interpreter) allocateElements(site token.Token, n int) error {
+	i.usage.elements += n
+	if i.limits.MaxElements > 0 && i.usage.elements > i.limits.MaxElements {
+		return i.exceed(LIMIT_ELEMENTS, site)
+	}
+	return nil
+}
+
+// Counts the value returned by a native function, which may have created it
+func (i *Interpreter) allocateResult(site token.Token, value LoxValue) error {
+	switch value := value.(type) {
+	case string:
+		return i.allocateString(site, value)
+	case *LoxList:
+		err := i.allocateInstance(site)
+		if err != nil {
+			return err
+		}
+		return i.allocateElements(site, len(value.elements))
+	case *LoxMap:
+		err := i.allocateInstance(site)
+		if err != nil {
+			return err
+		}
+		return i.allocateElements(site, value.Len())
+	case *HostInstance:
+		return i.allocateInstance(site)
+	}
+	return nil
+}
+
+func (l Limit) String() string {
+	switch l {
+	case LIMIT_STEPS:
+		return "steps"
+	case LIMIT_TIME:
+		return "time"
+	case LIMIT_INSTANCES:
+		return "instances"
+	case LIMIT_STRINGS:
+		return "strings"
+	case LIMIT_ELEMENTS:
+		return "elements"
+	}
+	return fmt.Sprintf("Limit(%d)", l)
+}
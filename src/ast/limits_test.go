@@ -0,0 +1,71 @@
+package ast_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/glox"
+)
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		limits glox.Limits
+		limit  ast.Limit
+		source string
+	}{
+		{"steps", glox.Limits{MaxSteps: 100}, ast.LIMIT_STEPS, "while (true) {}"},
+		{"time", glox.Limits{Timeout: 50 * time.Millisecond}, ast.LIMIT_TIME, "while (true) {}"},
+		{"instances", glox.Limits{MaxInstances: 10}, ast.LIMIT_INSTANCES, "class A {} while (true) { A(); }"},
+		{"lists", glox.Limits{MaxInstances: 10}, ast.LIMIT_INSTANCES, "while (true) { var l = [1]; }"},
+		{"host instances", glox.Limits{MaxInstances: 10}, ast.LIMIT_INSTANCES, "while (true) { point(); }"},
+		{"strings", glox.Limits{MaxStringBytes: 100}, ast.LIMIT_STRINGS, `var s = ""; while (true) { s = s + "x"; }`},
+		{"map entries", glox.Limits{MaxElements: 100}, ast.LIMIT_ELEMENTS, "var m = {}; var i = 0; while (true) { m[i] = i; i = i + 1; }"},
+		{"list elements", glox.Limits{MaxElements: 100}, ast.LIMIT_ELEMENTS, "while (true) { var l = [1, 2, 3]; }"},
+		{"native results", glox.Limits{MaxElements: 100}, ast.LIMIT_ELEMENTS, "var m = {1: 1, 2: 2}; while (true) { keys(m); }"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := glox.New(glox.WithLimits(c.limits), glox.WithStdout(&out))
+			err := l.Bind("point", func() *hostPoint { return &hostPoint{} })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkLimitError(t, l.Run(c.source, "limits.lox"), c.limit)
+
+			// the program's own catch clause can't intercept the limit, and
+			// nor can finally keep it going
+			caught := "try { " + c.source + ` } catch (e) { print "caught"; } finally { while (true) {} }`
+			checkLimitError(t, l.Run(caught, "limits.lox"), c.limit)
+			if out.Len() > 0 {
+				t.Errorf("the program printed %q", out.String())
+			}
+
+			// each run has a fresh allowance, so the interpreter can be used
+			// again
+			err = l.Run("var ok = 1 + 1;", "limits.lox")
+			if err != nil {
+				t.Fatalf("running after a LimitError: %s", err)
+			}
+			if ok, _ := l.GetGlobal("ok"); ok != 2.0 {
+				t.Errorf("ok = %v, want 2", ok)
+			}
+		})
+	}
+}
+
+func checkLimitError(t *testing.T, err error, limit ast.Limit) {
+	t.Helper()
+	limitErr, ok := err.(*glox.LimitError)
+	if !ok {
+		t.Fatalf("got %v (%T), want a *LimitError", err, err)
+	}
+	if limitErr.Limit() != limit {
+		t.Errorf("exceeded the %s limit, want %s", limitErr.Limit(), limit)
+	}
+}
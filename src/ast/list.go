@@ -0,0 +1,79 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+)
+
+type LoxList struct {
+	elements []LoxValue
+	// host is the Go slice or array the list was read from, if any, which
+	// assignments to its elements are written back to
+	host      reflect.Value
+	writeBack func()
+}
+
+func NewLoxList(elements []LoxValue) *LoxList {
+	return &LoxList{elements: elements}
+}
+
+func (l *LoxList) String() string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for j, element := range l.elements {
+		if j > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(ToString(element))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// Converts a Lox value into a usable index into the list, or reports why it
+// can't be used as one
+func (l *LoxList) checkIndex(bracket token.Token, index LoxValue) (int, error) {
+	fIndex, ok := index.(float64)
+	if !ok || fIndex != math.Trunc(fIndex) {
+		return 0, errors.NewRuntimeError(bracket, "List index must be an integer")
+	}
+
+	if fIndex < 0 || fIndex >= float64(len(l.elements)) {
+		return 0, errors.NewRuntimeError(bracket, fmt.Sprintf("List index %s out of range", ToString(index)))
+	}
+
+	return int(fIndex), nil
+}
+
+func (l *LoxList) Get(bracket token.Token, index LoxValue) (LoxValue, error) {
+	j, err := l.checkIndex(bracket, index)
+	if err != nil {
+		return nil, err
+	}
+	return l.elements[j], nil
+}
+
+func (l *LoxList) Set(bracket token.Token, index LoxValue, value LoxValue) error {
+	j, err := l.checkIndex(bracket, index)
+	if err != nil {
+		return err
+	}
+	if l.host.IsValid() {
+		element := l.host.Index(j)
+		converted, ok := FromLox(value, element.Type())
+		if !ok {
+			return errors.NewRuntimeError(bracket, fmt.Sprintf("List element must be %s", describeType(element.Type())))
+		}
+		element.Set(converted)
+		if l.writeBack != nil {
+			l.writeBack()
+		}
+	}
+	l.elements[j] = value
+	return nil
+}
@@ -0,0 +1,153 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+)
+
+// LoxMap is a hash map keyed by strings, numbers and booleans. Keys are
+// compared with isEqual, just as the == operator compares them, so 1 and "1"
+// are distinct keys while 0 and -0 are the same key. NaN is rejected as a key
+// because it is never equal to itself. Maps remember their insertion order
+// so that iterating over keys() and values() is deterministic.
+type LoxMap struct {
+	entries map[LoxValue]LoxValue
+	keys    []LoxValue
+	// host is the Go map the map was read from, if any, which changes to its
+	// entries are written back to
+	host reflect.Value
+}
+
+func NewLoxMap() *LoxMap {
+	return &LoxMap{
+		entries: make(map[LoxValue]LoxValue),
+		keys:    make([]LoxValue, 0),
+	}
+}
+
+// isHashable reports whether a value can be a map key: one that is compared
+// by value and is equal to itself. For these keys, the Go map's own
+// comparison agrees with isEqual.
+func isHashable(key LoxValue) bool {
+	switch key.(type) {
+	case string, bool, float64:
+		return isEqual(key, key)
+	}
+	return false
+}
+
+func (m *LoxMap) String() string {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for j, key := range m.keys {
+		if j > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s: %s", ToString(key), ToString(m.entries[key]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func (m *LoxMap) checkKey(brace token.Token, key LoxValue) error {
+	if !isHashable(key) {
+		return errors.NewRuntimeError(brace, "Map keys must be strings, numbers or booleans")
+	}
+	return nil
+}
+
+func (m *LoxMap) Get(brace token.Token, key LoxValue) (LoxValue, error) {
+	err := m.checkKey(brace, key)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := m.entries[key]
+	if !ok {
+		return nil, errors.NewRuntimeError(brace, fmt.Sprintf("Undefined key '%s'", ToString(key)))
+	}
+	return value, nil
+}
+
+func (m *LoxMap) Set(brace token.Token, key LoxValue, value LoxValue) error {
+	err := m.checkKey(brace, key)
+	if err != nil {
+		return err
+	}
+
+	if m.host.IsValid() {
+		hostType := m.host.Type()
+		convertedKey, ok := FromLox(key, hostType.Key())
+		if !ok {
+			return errors.NewRuntimeError(brace, fmt.Sprintf("Map key must be %s", describeType(hostType.Key())))
+		}
+		convertedValue, ok := FromLox(value, hostType.Elem())
+		if !ok {
+			return errors.NewRuntimeError(brace, fmt.Sprintf("Map value must be %s", describeType(hostType.Elem())))
+		}
+		m.host.SetMapIndex(convertedKey, convertedValue)
+	}
+	m.put(key, value)
+	return nil
+}
+
+// put assumes that the key has already been checked with isHashable
+func (m *LoxMap) put(key LoxValue, value LoxValue) {
+	if _, ok := m.entries[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = value
+}
+
+func (m *LoxMap) Has(key LoxValue) bool {
+	if !isHashable(key) {
+		return false
+	}
+	_, ok := m.entries[key]
+	return ok
+}
+
+// Remove deletes the key from the map, returning the value it held (or nil if
+// the key wasn't present)
+func (m *LoxMap) Remove(key LoxValue) LoxValue {
+	if !m.Has(key) {
+		return nil
+	}
+
+	if m.host.IsValid() {
+		// the key must have come from the Go map, so it converts back
+		convertedKey, _ := FromLox(key, m.host.Type().Key())
+		m.host.SetMapIndex(convertedKey, reflect.Value{})
+	}
+	value := m.entries[key]
+	delete(m.entries, key)
+	for j, k := range m.keys {
+		if isEqual(k, key) {
+			m.keys = append(m.keys[:j], m.keys[j+1:]...)
+			break
+		}
+	}
+	return value
+}
+
+func (m *LoxMap) Keys() []LoxValue {
+	keys := make([]LoxValue, len(m.keys))
+	copy(keys, m.keys)
+	return keys
+}
+
+func (m *LoxMap) Values() []LoxValue {
+	values := make([]LoxValue, len(m.keys))
+	for j, key := range m.keys {
+		values[j] = m.entries[key]
+	}
+	return values
+}
+
+func (m *LoxMap) Len() int {
+	return len(m.keys)
+}
@@ -0,0 +1,44 @@
+package ast
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+)
+
+// A LoxModule is the namespace created by executing a single file. Every module
+// has its own global environment, whose parent holds the natives shared by all
+// modules, and its own table of locals produced by the resolver.
+type LoxModule struct {
+	path    string
+	globals *Environment
+	locals  map[token.Token]int
+}
+
+func NewLoxModule(path string, builtins *Environment) *LoxModule {
+	return &LoxModule{
+		path:    path,
+		globals: NewEnvironment(builtins),
+		locals:  make(map[token.Token]int),
+	}
+}
+
+func (m *LoxModule) String() string {
+	return fmt.Sprintf("<module %s>", filepath.Base(m.path))
+}
+
+// Get looks up one of the module's globals. Natives are deliberately not
+// visible through the namespace.
+func (m *LoxModule) Get(name token.Token) (LoxValue, error) {
+	if value, ok := m.globals.variables[name.Lexeme]; ok {
+		return value, nil
+	}
+	return nil, errors.NewRuntimeError(name, fmt.Sprintf("Undefined module member '%s'", name.Lexeme))
+}
+
+// A ModuleLoader scans, parses and resolves the file at the given path. It is
+// called with the interpreter already switched into the new module, so that
+// the resolver records locals against the right module.
+type ModuleLoader func(path string) ([]Stmt, error)
@@ -0,0 +1,73 @@
+package ast
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// VARIADIC is the arity of natives that accept any number of arguments
+const VARIADIC = -1
+
+func fixedArity(n int) arityFn {
+	return func() int { return n }
+}
+
+func defineCollectionNatives(env *Environment) {
+	defineNative(env, "len", NewNativeFunction(fixedArity(1), nativeLen))
+	defineNative(env, "keys", NewNativeFunction(fixedArity(1), nativeKeys))
+	defineNative(env, "values", NewNativeFunction(fixedArity(1), nativeValues))
+	defineNative(env, "has", NewNativeFunction(fixedArity(2), nativeHas))
+	defineNative(env, "remove", NewNativeFunction(fixedArity(2), nativeRemove))
+}
+
+func nativeLen(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	switch v := args[0].(type) {
+	case *LoxList:
+		return float64(len(v.elements)), nil
+	case *LoxMap:
+		return float64(v.Len()), nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	}
+	return nil, NewNativeError("len() expects a list, map or string")
+}
+
+func mapArg(name string, arg LoxValue) (*LoxMap, error) {
+	m, ok := arg.(*LoxMap)
+	if !ok {
+		return nil, NewNativeError(fmt.Sprintf("%s() expects a map", name))
+	}
+	return m, nil
+}
+
+func nativeKeys(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	m, err := mapArg("keys", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return NewLoxList(m.Keys()), nil
+}
+
+func nativeValues(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	m, err := mapArg("values", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return NewLoxList(m.Values()), nil
+}
+
+func nativeHas(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	m, err := mapArg("has", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.Has(args[1]), nil
+}
+
+func nativeRemove(args []LoxValue, _ *Interpreter) (LoxValue, error) {
+	m, err := mapArg("remove", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.Remove(args[1]), nil
+}
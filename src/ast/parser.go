@@ -23,7 +23,9 @@ func (p *Parser) Parse() ([]Stmt, bool) {
 	for !p.atEnd() {
 		stmt, err := p.declaration()
 		if err != nil {
-			return statements, !p.errored
+			// the error has been reported and the parser has synchronized to
+			// the next statement, so carry on to find any other errors
+			continue
 		}
 		statements = append(statements, stmt)
 	}
@@ -31,22 +33,35 @@ func (p *Parser) Parse() ([]Stmt, bool) {
 	return statements, !p.errored
 }
 
+// ParseExpression parses source that consists of a single expression, which
+// may be followed by a semicolon
 func (p *Parser) ParseExpression() (Expr, bool) {
 	expr, err := p.expression()
 	if err != nil {
 		return nil, !p.errored
 	}
 
+	p.match(token.SEMICOLON)
+	if !p.atEnd() {
+		p.error(p.peek(), "Expect end of expression")
+		return nil, false
+	}
+
 	return expr, !p.errored
 }
 
 func (p *Parser) declaration() (Stmt, error) {
 	var value Stmt
 	var err error
-	if p.match(token.FUN) {
+	// "fun" followed by a parameter list is an anonymous function expression,
+	// which is parsed as part of an expression statement below
+	if p.check(token.FUN) && p.checkNext(token.IDENTIFIER) {
+		p.advance()
 		value, err = p.function("function")
 	} else if p.match(token.VAR) {
 		value, err = p.varDeclaration()
+	} else if p.match(token.IMPORT) {
+		value, err = p.importDeclaration()
 	} else {
 		value, err = p.statement()
 	}
@@ -69,6 +84,18 @@ func (p *Parser) function(kind string) (Stmt, error) {
 		return nil, err
 	}
 
+	params, body, err := p.functionBody(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return FunctionStmt{name, params, body}, nil
+}
+
+// functionBody() parses the parameter list and body shared by named and
+// anonymous functions. It assumes that the opening parenthesis of the
+// parameter list has already been consumed.
+func (p *Parser) functionBody(kind string) ([]token.Token, []Stmt, error) {
 	params := make([]token.Token, 0)
 	if !p.check(token.RIGHT_PAREN) {
 		matchedComma := true
@@ -77,34 +104,35 @@ func (p *Parser) function(kind string) (Stmt, error) {
 				p.error(p.peek(), "Can't have more than 255 parameters")
 			}
 
-			param, paramErr := p.consume(token.IDENTIFIER, "Expect parameter name")
-			if paramErr != nil {
-				return nil, err
+			param, err := p.consume(token.IDENTIFIER, "Expect parameter name")
+			if err != nil {
+				return nil, nil, err
 			}
 
 			params = append(params, param)
 			matchedComma = p.match(token.COMMA)
 		}
 	}
-	_, err = p.consume(token.RIGHT_PAREN, "Expect ')' after parameters")
+	_, err := p.consume(token.RIGHT_PAREN, "Expect ')' after parameters")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	_, err = p.consume(token.LEFT_BRACE, fmt.Sprintf("Expect '{' before %s body", kind))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	body, err := p.block()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return FunctionStmt{name, params, body}, nil
+	return params, body, nil
 }
 
 func (p *Parser) varDeclaration() (Stmt, error) {
+	keyword := p.previous()
 	name, err := p.consume(token.IDENTIFIER, "Expect variable name")
 	if err != nil {
 		return nil, err
@@ -123,7 +151,32 @@ func (p *Parser) varDeclaration() (Stmt, error) {
 		return nil, err
 	}
 
-	return VarStmt{name, initializer}, nil
+	return VarStmt{keyword, name, initializer}, nil
+}
+
+func (p *Parser) importDeclaration() (Stmt, error) {
+	keyword := p.previous()
+	path, err := p.consume(token.STRING, "Expect module path after 'import'")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(token.AS, "Expect 'as' after module path")
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := p.consume(token.IDENTIFIER, "Expect module name after 'as'")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after import")
+	if err != nil {
+		return nil, err
+	}
+
+	return ImportStmt{keyword, path, name}, nil
 }
 
 func (p *Parser) statement() (Stmt, error) {
@@ -158,15 +211,22 @@ func (p *Parser) statement() (Stmt, error) {
 	if p.match(token.RETURN) {
 		return p.returnStatement()
 	}
+	if p.match(token.THROW) {
+		return p.throwStatement()
+	}
+	if p.match(token.TRY) {
+		return p.tryStatement()
+	}
 	if p.match(token.WHILE) {
 		return p.whileStatement()
 	}
 	if p.match(token.LEFT_BRACE) {
+		brace := p.previous()
 		block, err := p.block()
 		if err != nil {
 			return nil, err
 		}
-		return BlockStmt{block}, nil
+		return BlockStmt{brace, block}, nil
 	}
 
 	return p.expressionStatement()
@@ -210,6 +270,7 @@ func (p *Parser) classDeclaration() (Stmt, error) {
 }
 
 func (p *Parser) forStatement() (Stmt, error) {
+	keyword := p.previous()
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'for'")
 	if err != nil {
 		return nil, err
@@ -258,28 +319,31 @@ func (p *Parser) forStatement() (Stmt, error) {
 		return nil, err
 	}
 
-	// desugar the loop construction into ({ initializer; while (condition) { body; increment; } })
+	// desugar the loop construction into ({ initializer; while (condition) body }),
+	// with the while loop running the increment after the body, so that
+	// continue doesn't skip it
 
-	if increment != nil {
-		body = BlockStmt{
-			statements: []Stmt{body, ExpressionStmt{increment}},
-		}
+	loopCondition := condition
+	if loopCondition == nil {
+		loopCondition = LiteralExpr{keyword, true}
 	}
-
-	if condition != nil {
-		body = WhileStmt{condition, body}
+	var loopIncrement Stmt
+	if increment != nil {
+		loopIncrement = ExpressionStmt{increment}
 	}
+	var loop Stmt = WhileStmt{keyword, loopCondition, body, loopIncrement}
 
 	if initializer != nil {
-		body = BlockStmt{
-			statements: []Stmt{initializer, body},
+		loop = BlockStmt{
+			statements: []Stmt{initializer, loop},
 		}
 	}
 
-	return body, nil
+	return ForStmt{keyword, initializer, condition, increment, body, loop}, nil
 }
 
 func (p *Parser) ifStatement() (Stmt, error) {
+	keyword := p.previous()
 	p.consume(token.LEFT_PAREN, "Expect '(' after 'if'")
 	condition, err := p.expression()
 	if err != nil {
@@ -304,11 +368,12 @@ func (p *Parser) ifStatement() (Stmt, error) {
 		}
 	}
 
-	return IfStmt{condition, thenBranch, elseBranch}, nil
+	return IfStmt{keyword, condition, thenBranch, elseBranch}, nil
 
 }
 
 func (p *Parser) printStatement() (Stmt, error) {
+	keyword := p.previous()
 	expr, err := p.expression()
 	if err != nil {
 		return expr, err
@@ -317,7 +382,7 @@ func (p *Parser) printStatement() (Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return PrintStmt{expr}, nil
+	return PrintStmt{keyword, expr}, nil
 }
 
 func (p *Parser) returnStatement() (Stmt, error) {
@@ -340,7 +405,80 @@ func (p *Parser) returnStatement() (Stmt, error) {
 	return ReturnStmt{keyword, returnVal}, nil
 }
 
+func (p *Parser) throwStatement() (Stmt, error) {
+	keyword := p.previous()
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after thrown value")
+	if err != nil {
+		return nil, err
+	}
+
+	return ThrowStmt{keyword, value}, nil
+}
+
+func (p *Parser) tryStatement() (Stmt, error) {
+	keyword := p.previous()
+	brace, err := p.consume(token.LEFT_BRACE, "Expect '{' after 'try'")
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+
+	var catchParam token.Token
+	var catchBlock *BlockStmt = nil
+	if p.match(token.CATCH) {
+		_, err = p.consume(token.LEFT_PAREN, "Expect '(' after 'catch'")
+		if err != nil {
+			return nil, err
+		}
+		catchParam, err = p.consume(token.IDENTIFIER, "Expect error variable name")
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(token.RIGHT_PAREN, "Expect ')' after error variable name")
+		if err != nil {
+			return nil, err
+		}
+		catchBrace, err := p.consume(token.LEFT_BRACE, "Expect '{' before catch body")
+		if err != nil {
+			return nil, err
+		}
+		statements, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		catchBlock = &BlockStmt{catchBrace, statements}
+	}
+
+	var finallyBlock *BlockStmt = nil
+	if p.match(token.FINALLY) {
+		finallyBrace, err := p.consume(token.LEFT_BRACE, "Expect '{' after 'finally'")
+		if err != nil {
+			return nil, err
+		}
+		statements, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		finallyBlock = &BlockStmt{finallyBrace, statements}
+	}
+
+	if catchBlock == nil && finallyBlock == nil {
+		return nil, p.error(p.peek(), "Expect 'catch' or 'finally' after try block")
+	}
+
+	return TryStmt{keyword, BlockStmt{brace, body}, catchParam, catchBlock, finallyBlock}, nil
+}
+
 func (p *Parser) whileStatement() (Stmt, error) {
+	keyword := p.previous()
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'while'")
 	if err != nil {
 		return nil, err
@@ -358,7 +496,7 @@ func (p *Parser) whileStatement() (Stmt, error) {
 		return nil, err
 	}
 
-	return WhileStmt{cond, body}, nil
+	return WhileStmt{keyword, cond, body, nil}, nil
 }
 
 func (p *Parser) expressionStatement() (Stmt, error) {
@@ -380,7 +518,8 @@ func (p *Parser) block() ([]Stmt, error) {
 	for !p.check(token.RIGHT_BRACE) && !p.atEnd() {
 		stmt, err := p.declaration()
 		if err != nil {
-			return nil, err
+			// already reported and recovered from, as in Parse
+			continue
 		}
 		statements = append(statements, stmt)
 	}
@@ -411,6 +550,13 @@ func (p *Parser) check(t token.TokenType) bool {
 	return p.peek().TokenType == t
 }
 
+func (p *Parser) checkNext(t token.TokenType) bool {
+	if p.atEnd() {
+		return false
+	}
+	return p.tokens[p.current+1].TokenType == t
+}
+
 func (p *Parser) advance() token.Token {
 	if !p.atEnd() {
 		p.current++
@@ -452,6 +598,8 @@ func (p *Parser) assignment() (Expr, error) {
 			return AssignmentExpr{receiver.name, value}, nil
 		} else if getter, ok := expr.(GetExpr); ok {
 			return SetExpr{getter.object, getter.name, value}, nil
+		} else if indexer, ok := expr.(IndexExpr); ok {
+			return IndexSetExpr{indexer.object, indexer.bracket, indexer.index, value}, nil
 		}
 
 		return nil, p.error(tok, "Invalid assignment target")
@@ -628,6 +776,16 @@ func (p *Parser) call() (Expr, error) {
 				return nil, err
 			}
 			expr = GetExpr{expr, name}
+		} else if p.match(token.LEFT_BRACKET) {
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			bracket, err := p.consume(token.RIGHT_BRACKET, "Expect ']' after index")
+			if err != nil {
+				return nil, err
+			}
+			expr = IndexExpr{expr, bracket, index}
 		} else {
 			break
 		}
@@ -663,24 +821,99 @@ func (p *Parser) finishCall(callee Expr) (Expr, error) {
 	return CallExpr{callee, token, args}, nil
 }
 
+// list() assumes that the opening bracket has already been consumed
+func (p *Parser) list() (Expr, error) {
+	elements := make([]Expr, 0)
+	if !p.check(token.RIGHT_BRACKET) {
+		matchedComma := true
+		for matchedComma {
+			if len(elements) >= 255 {
+				p.error(p.peek(), "Maximum list literal elements reached (255)")
+			}
+			expr, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, expr)
+			matchedComma = p.match(token.COMMA)
+		}
+	}
+
+	bracket, err := p.consume(token.RIGHT_BRACKET, "Expect ']' after list elements")
+	if err != nil {
+		return nil, err
+	}
+
+	return ListExpr{bracket, elements}, nil
+}
+
+// mapLiteral() assumes that the opening brace has already been consumed
+func (p *Parser) mapLiteral() (Expr, error) {
+	keys := make([]Expr, 0)
+	values := make([]Expr, 0)
+	if !p.check(token.RIGHT_BRACE) {
+		matchedComma := true
+		for matchedComma {
+			if len(keys) >= 255 {
+				p.error(p.peek(), "Maximum map literal entries reached (255)")
+			}
+			key, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			_, err = p.consume(token.COLON, "Expect ':' after map key")
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			values = append(values, value)
+			matchedComma = p.match(token.COMMA)
+		}
+	}
+
+	brace, err := p.consume(token.RIGHT_BRACE, "Expect '}' after map entries")
+	if err != nil {
+		return nil, err
+	}
+
+	return MapExpr{brace, keys, values}, nil
+}
+
 func (p *Parser) primary() (Expr, error) {
 	if p.match(token.FALSE) {
-		return LiteralExpr{false}, nil
+		return LiteralExpr{p.previous(), false}, nil
 	}
 	if p.match(token.TRUE) {
-		return LiteralExpr{true}, nil
+		return LiteralExpr{p.previous(), true}, nil
 	}
 	if p.match(token.NIL) {
-		return LiteralExpr{nil}, nil
+		return LiteralExpr{p.previous(), nil}, nil
 	}
 
 	if p.match(token.NUMBER, token.STRING) {
-		return LiteralExpr{p.previous().Literal}, nil
+		return LiteralExpr{p.previous(), p.previous().Literal}, nil
 	}
 
 	if p.match(token.THIS) {
 		return ThisExpr{p.previous()}, nil
 	}
+	if p.match(token.FUN) {
+		keyword := p.previous()
+		_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'fun'")
+		if err != nil {
+			return nil, err
+		}
+
+		params, body, err := p.functionBody("function")
+		if err != nil {
+			return nil, err
+		}
+		return FunctionExpr{keyword, params, body}, nil
+	}
 	if p.match(token.SUPER) {
 		keyword := p.previous()
 		_, err := p.consume(token.DOT, "Expect '.' after 'super'")
@@ -699,7 +932,16 @@ func (p *Parser) primary() (Expr, error) {
 		return VariableExpr{p.previous()}, nil
 	}
 
+	if p.match(token.LEFT_BRACKET) {
+		return p.list()
+	}
+
+	if p.match(token.LEFT_BRACE) {
+		return p.mapLiteral()
+	}
+
 	if p.match(token.LEFT_PAREN) {
+		paren := p.previous()
 		expr, err := p.expression()
 		if err != nil {
 			return nil, err
@@ -708,7 +950,7 @@ func (p *Parser) primary() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return GroupingExpr{expr}, nil
+		return GroupingExpr{paren, expr}, nil
 	}
 
 	return nil, p.error(p.peek(), "expected expression")
@@ -742,6 +984,8 @@ func (p *Parser) synchronize() {
 			fallthrough
 		case token.FUN:
 			fallthrough
+		case token.IMPORT:
+			fallthrough
 		case token.VAR:
 			fallthrough
 		case token.FOR:
@@ -753,6 +997,10 @@ func (p *Parser) synchronize() {
 		case token.PRINT:
 			fallthrough
 		case token.RETURN:
+			fallthrough
+		case token.THROW:
+			fallthrough
+		case token.TRY:
 			return
 		}
 
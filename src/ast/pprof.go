@@ -0,0 +1,196 @@
+package ast
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format read by
+// `go tool pprof`. Each sample is a line of a function, reached through a
+// particular stack of calls, with the number of statements run there and the
+// time they took.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	var out pprofBuilder
+	out.strings = map[string]int{"": 0}
+	out.stringTable = []string{""}
+	out.functions = make(map[*FunctionProfile]uint64)
+	out.locations = make(map[profileNodeKey]uint64)
+	out.files = make(map[*FunctionProfile]string)
+	var findFiles func(node *profileNode)
+	findFiles = func(node *profileNode) {
+		for _, child := range node.children {
+			if child.line.file != "" {
+				out.files[child.function] = child.line.file
+			}
+			findFiles(child)
+		}
+	}
+	findFiles(p.root)
+
+	// Profile.sample_type, a ValueType of type and unit
+	for _, sampleType := range [][2]string{{"statements", "count"}, {"time", "nanoseconds"}} {
+		var valueType protoBuffer
+		valueType.uint64(1, uint64(out.string(sampleType[0])))
+		valueType.uint64(2, uint64(out.string(sampleType[1])))
+		out.profile.message(1, valueType.Bytes())
+	}
+
+	var walk func(node *profileNode, stack []uint64)
+	walk = func(node *profileNode, stack []uint64) {
+		for _, child := range node.children {
+			// locations are listed innermost first
+			childStack := append([]uint64{out.location(child)}, stack...)
+			if child.count > 0 || child.self > 0 {
+				var sample protoBuffer
+				sample.uint64s(1, childStack)
+				sample.int64s(2, []int64{int64(child.count), child.self.Nanoseconds()})
+				out.profile.message(2, sample.Bytes())
+			}
+			walk(child, childStack)
+		}
+	}
+	walk(p.root, nil)
+
+	out.profile.Write(out.locationTable.Bytes())
+	out.profile.Write(out.functionTable.Bytes())
+	for _, s := range out.stringTable {
+		out.profile.string(6, s)
+	}
+	out.profile.uint64(9, uint64(p.runStart.UnixNano()))
+	out.profile.uint64(10, uint64(p.script.Total.Nanoseconds()))
+
+	zw := gzip.NewWriter(w)
+	_, err := zw.Write(out.profile.Bytes())
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Collects the tables of a pprof Profile message, which refer to each other by
+// id or by index
+type pprofBuilder struct {
+	profile       protoBuffer
+	locationTable protoBuffer
+	functionTable protoBuffer
+	strings       map[string]int
+	stringTable   []string
+	functions     map[*FunctionProfile]uint64
+	locations     map[profileNodeKey]uint64
+	// the file each function's lines are in
+	files map[*FunctionProfile]string
+}
+
+func (b *pprofBuilder) string(s string) int {
+	index, ok := b.strings[s]
+	if !ok {
+		index = len(b.stringTable)
+		b.strings[s] = index
+		b.stringTable = append(b.stringTable, s)
+	}
+	return index
+}
+
+// Returns the id of the Location for a node's function and line, adding it to
+// Profile.location if it's new
+func (b *pprofBuilder) location(node *profileNode) uint64 {
+	key := profileNodeKey{node.function, node.line}
+	id, ok := b.locations[key]
+	if ok {
+		return id
+	}
+	id = uint64(len(b.locations) + 1)
+	b.locations[key] = id
+
+	var line protoBuffer
+	line.uint64(1, b.function(node.function))
+	line.uint64(2, uint64(node.line.line))
+	var location protoBuffer
+	location.uint64(1, id)
+	location.message(4, line.Bytes())
+	b.locationTable.message(4, location.Bytes())
+	return id
+}
+
+// Returns the id of the Function for a profiled function, adding it to
+// Profile.function if it's new
+func (b *pprofBuilder) function(function *FunctionProfile) uint64 {
+	id, ok := b.functions[function]
+	if ok {
+		return id
+	}
+	id = uint64(len(b.functions) + 1)
+	b.functions[function] = id
+
+	// pprof drops anything in angle brackets from names, as C++ template
+	// arguments, so "<script>" would come out empty
+	name := strings.Trim(function.Name, "<>")
+	var message protoBuffer
+	message.uint64(1, id)
+	message.uint64(2, uint64(b.string(name)))
+	message.uint64(3, uint64(b.string(name)))
+	message.uint64(4, uint64(b.string(b.files[function])))
+	b.functionTable.message(5, message.Bytes())
+	return id
+}
+
+// protoBuffer encodes the few protocol buffer field types a profile needs
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+// protocol buffer wire types
+const (
+	protoVarint = 0
+	protoBytes  = 2
+)
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	b.WriteByte(byte(x))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, protoVarint)
+	b.varint(x)
+}
+
+func (b *protoBuffer) uint64s(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.message(field, packed.Bytes())
+}
+
+func (b *protoBuffer) int64s(field int, xs []int64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+	b.message(field, packed.Bytes())
+}
+
+// Strings are always written, even when empty, since the string table is
+// indexed by position
+func (b *protoBuffer) string(field int, s string) {
+	b.message(field, []byte(s))
+}
+
+func (b *protoBuffer) message(field int, message []byte) {
+	b.key(field, protoBytes)
+	b.varint(uint64(len(message)))
+	b.Write(message)
+}
@@ -3,43 +3,225 @@ package ast
 import (
 	"fmt"
 	"strings"
+
+	"github.com/faideww/glox/src/token"
 )
 
+// Printable nodes print themselves as S-expressions, which shows how the
+// parser has grouped and desugared the program
 type Printable interface {
 	Print() string
 }
 
+func (bs BlockStmt) Print() string {
+	return parenthesize("block", bs.statements)
+}
+
+func (bs BreakStmt) Print() string {
+	return "(break)"
+}
+
+func (cs ClassStmt) Print() string {
+	parts := []interface{}{cs.name}
+	if cs.superclass != nil {
+		parts = append(parts, "<", cs.superclass.name)
+	}
+	for _, method := range cs.methods {
+		parts = append(parts, method)
+	}
+	return parenthesize("class", parts...)
+}
+
+func (cs ContinueStmt) Print() string {
+	return "(continue)"
+}
+
+func (es ExpressionStmt) Print() string {
+	return parenthesize(";", es.expression)
+}
+
+// for loops print as the while loop they are desugared into
+func (fs ForStmt) Print() string {
+	return fs.loop.(Printable).Print()
+}
+
+func (fs FunctionStmt) Print() string {
+	return parenthesize("fun", fs.name, fs.params, fs.body)
+}
+
+func (is IfStmt) Print() string {
+	if is.elseBranch == nil {
+		return parenthesize("if", is.condition, is.thenBranch)
+	}
+	return parenthesize("if-else", is.condition, is.thenBranch, is.elseBranch)
+}
+
+func (is ImportStmt) Print() string {
+	return parenthesize("import", is.path, "as", is.name)
+}
+
+func (ps PrintStmt) Print() string {
+	return parenthesize("print", ps.expression)
+}
+
+func (rs ReturnStmt) Print() string {
+	if rs.value == nil {
+		return "(return)"
+	}
+	return parenthesize("return", rs.value)
+}
+
+func (ts ThrowStmt) Print() string {
+	return parenthesize("throw", ts.value)
+}
+
+func (ts TryStmt) Print() string {
+	parts := []interface{}{ts.body}
+	if ts.catchBlock != nil {
+		parts = append(parts, parenthesize("catch", ts.catchParam, *ts.catchBlock))
+	}
+	if ts.finallyBlock != nil {
+		parts = append(parts, parenthesize("finally", *ts.finallyBlock))
+	}
+	return parenthesize("try", parts...)
+}
+
+func (vs VarStmt) Print() string {
+	if vs.initializer == nil {
+		return parenthesize("var", vs.name)
+	}
+	return parenthesize("var", vs.name, "=", vs.initializer)
+}
+
+func (ws WhileStmt) Print() string {
+	if ws.increment == nil {
+		return parenthesize("while", ws.condition, ws.body)
+	}
+	return parenthesize("while", ws.condition, ws.body, ws.increment)
+}
+
+func (a AssignmentExpr) Print() string {
+	return parenthesize("=", a.name, a.value)
+}
+
+func (b BinaryExpr) Print() string {
+	return parenthesize(b.operator.Lexeme, b.left, b.right)
+}
+
+func (c CallExpr) Print() string {
+	return parenthesize("call", c.callee, c.arguments)
+}
+
+func (f FunctionExpr) Print() string {
+	return parenthesize("fun", f.params, f.body)
+}
+
+func (g GetExpr) Print() string {
+	return parenthesize(".", g.object, g.name)
+}
+
+func (g GroupingExpr) Print() string {
+	return parenthesize("group", g.expression)
+}
+
+func (ie IndexExpr) Print() string {
+	return parenthesize("[]", ie.object, ie.index)
+}
+
+func (is IndexSetExpr) Print() string {
+	return parenthesize("[]=", is.object, is.index, is.value)
+}
+
+func (l ListExpr) Print() string {
+	return parenthesize("list", l.elements)
+}
+
 func (l LiteralExpr) Print() string {
-	if l.value == nil {
+	switch value := l.value.(type) {
+	case nil:
 		return "nil"
+	case string:
+		return fmt.Sprintf("%q", value)
 	}
 	return fmt.Sprintf("%v", l.value)
 }
 
-func (u UnaryExpr) Print() string {
-	return parenthesize(u.operator.Lexeme, u.right.(Printable))
+func (l LogicalExpr) Print() string {
+	return parenthesize(l.operator.Lexeme, l.left, l.right)
 }
 
-func (b BinaryExpr) Print() string {
-	return parenthesize(b.operator.Lexeme, b.left.(Printable), b.right.(Printable))
+func (m MapExpr) Print() string {
+	entries := make([]interface{}, len(m.keys))
+	for i, key := range m.keys {
+		entries[i] = parenthesize(":", key, m.values[i])
+	}
+	return parenthesize("map", entries...)
+}
+
+func (s SetExpr) Print() string {
+	return parenthesize("=", parenthesize(".", s.obj, s.name), s.value)
+}
+
+func (s SuperExpr) Print() string {
+	return parenthesize("super", s.method)
 }
 
 func (t TernaryExpr) Print() string {
-	return parenthesize("?:", t.condition.(Printable), t.left.(Printable), t.right.(Printable))
+	return parenthesize("?:", t.condition, t.left, t.right)
 }
 
-func (g GroupingExpr) Print() string {
-	return parenthesize("group", g.expression.(Printable))
+func (t ThisExpr) Print() string {
+	return "this"
 }
 
-func parenthesize(name string, exprs ...Printable) string {
+func (u UnaryExpr) Print() string {
+	return parenthesize(u.operator.Lexeme, u.right)
+}
+
+func (v VariableExpr) Print() string {
+	return v.name.Lexeme
+}
+
+// parenthesize prints an S-expression. Parts can be nodes, tokens (printed as
+// their lexemes), strings, or lists of any of those, which are printed inline
+// except for parameter lists, which are wrapped in parentheses.
+func parenthesize(name string, parts ...interface{}) string {
 	var sb strings.Builder
 
 	fmt.Fprintf(&sb, "(%s", name)
-	for _, expr := range exprs {
-		fmt.Fprintf(&sb, " %s", expr.Print())
+	for _, part := range parts {
+		// empty lists print nothing
+		if printed := printPart(part); printed != "" {
+			fmt.Fprintf(&sb, " %s", printed)
+		}
 	}
 	fmt.Fprintf(&sb, ")")
 
 	return sb.String()
 }
+
+func printPart(part interface{}) string {
+	switch part := part.(type) {
+	case Printable:
+		return part.Print()
+	case token.Token:
+		return part.Lexeme
+	case string:
+		return part
+	case []token.Token:
+		return "(" + strings.Join(lexemes(part), " ") + ")"
+	case []Stmt:
+		printed := make([]string, len(part))
+		for i, stmt := range part {
+			printed[i] = printPart(stmt)
+		}
+		return strings.Join(printed, " ")
+	case []Expr:
+		printed := make([]string, len(part))
+		for i, expr := range part {
+			printed[i] = printPart(expr)
+		}
+		return strings.Join(printed, " ")
+	}
+	return fmt.Sprintf("%v", part)
+}
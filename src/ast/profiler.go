@@ -0,0 +1,355 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+)
+
+type ProfileKind int
+
+const (
+	// PROFILE_SCRIPT is the top level of the program being run
+	PROFILE_SCRIPT ProfileKind = iota
+	PROFILE_FUNCTION
+	PROFILE_NATIVE
+	// PROFILE_INITIALIZER is a call to a class, which runs its init method
+	PROFILE_INITIALIZER
+	// PROFILE_MODULE is the top level of an imported module
+	PROFILE_MODULE
+)
+
+// PROFILE_TOP_LINES is how many of the slowest lines the summary shows
+const PROFILE_TOP_LINES = 20
+
+// A Profiler records where a program spends its time. Time is measured
+// between statements, so each interval is charged to the statement that was
+// running and to the function it belongs to. Native functions are charged
+// for the time they take, and their line for the statement that called them.
+type Profiler struct {
+	functions map[profileKey]*FunctionProfile
+	lines     map[profileLine]*LineProfile
+	script    *FunctionProfile
+	// calls form a tree, with a node for each line of each function along
+	// every path of calls that reached it. A node's children are the calls
+	// made from its line, and the lines of a function are siblings.
+	root *profileNode
+	// the current position, and the positions to return to from each call
+	node  *profileNode
+	line  *LineProfile
+	calls []profileCall
+	// runs counts the calls to Interpret that are in progress, since time is
+	// only measured while a program is running
+	runs     int
+	runStart time.Time
+	last     time.Time
+}
+
+// FunctionProfile is the time spent in one function
+type FunctionProfile struct {
+	Name  string
+	Kind  ProfileKind
+	Calls int
+	// Total includes the time spent in the functions it called, and Self
+	// doesn't
+	Total time.Duration
+	Self  time.Duration
+	// how many calls to it are in progress, so that recursive calls aren't
+	// counted towards its total twice
+	active int
+}
+
+// LineProfile is the time spent running the statements on one line
+type LineProfile struct {
+	File  string
+	Line  int
+	Count int
+	Time  time.Duration
+}
+
+type profileKey struct {
+	name string
+	kind ProfileKind
+}
+
+type profileLine struct {
+	file string
+	line int
+}
+
+type profileNode struct {
+	function *FunctionProfile
+	line     profileLine
+	parent   *profileNode
+	children map[profileNodeKey]*profileNode
+	self     time.Duration
+	count    int
+}
+
+type profileNodeKey struct {
+	function *FunctionProfile
+	line     profileLine
+}
+
+type profileCall struct {
+	node  *profileNode
+	line  *LineProfile
+	start time.Time
+}
+
+func NewProfiler() *Profiler {
+	p := &Profiler{
+		functions: make(map[profileKey]*FunctionProfile),
+		lines:     make(map[profileLine]*LineProfile),
+		root:      &profileNode{children: make(map[profileNodeKey]*profileNode)},
+	}
+	p.script = p.function("<script>", PROFILE_SCRIPT)
+	p.node = p.root.child(p.script, profileLine{})
+	return p
+}
+
+// WithProfiler records where programs spend their time
+func WithProfiler(p *Profiler) InterpreterOption {
+	return func(i *Interpreter) {
+		i.profiler = p
+	}
+}
+
+func (n *profileNode) child(function *FunctionProfile, line profileLine) *profileNode {
+	key := profileNodeKey{function, line}
+	child, ok := n.children[key]
+	if !ok {
+		child = &profileNode{function: function, line: line, parent: n, children: make(map[profileNodeKey]*profileNode)}
+		n.children[key] = child
+	}
+	return child
+}
+
+func (p *Profiler) function(name string, kind ProfileKind) *FunctionProfile {
+	key := profileKey{name, kind}
+	function, ok := p.functions[key]
+	if !ok {
+		function = &FunctionProfile{Name: name, Kind: kind}
+		p.functions[key] = function
+	}
+	return function
+}
+
+// Charges the time since the last event to the current function and line
+func (p *Profiler) charge() time.Time {
+	now := time.Now()
+	elapsed := now.Sub(p.last)
+	p.node.self += elapsed
+	p.node.function.Self += elapsed
+	if p.line != nil {
+		p.line.Time += elapsed
+	}
+	p.last = now
+	return now
+}
+
+func (p *Profiler) start() {
+	p.runs++
+	if p.runs == 1 {
+		p.runStart = time.Now()
+		p.last = p.runStart
+		p.script.Calls++
+	}
+}
+
+func (p *Profiler) stop() {
+	p.runs--
+	if p.runs == 0 {
+		now := p.charge()
+		p.script.Total += now.Sub(p.runStart)
+	}
+}
+
+// Called before each statement
+func (p *Profiler) statement(site token.Token) {
+	p.charge()
+	key := profileLine{site.File(), site.Line}
+	line, ok := p.lines[key]
+	if !ok {
+		line = &LineProfile{File: key.file, Line: key.line}
+		p.lines[key] = line
+	}
+	line.Count++
+	p.line = line
+
+	if p.node.line != key {
+		p.node = p.node.parent.child(p.node.function, key)
+	}
+	p.node.count++
+}
+
+// Called as a function starts
+func (p *Profiler) enter(frame errors.StackFrame, kind ProfileKind) {
+	now := p.charge()
+	function := p.function(frame.String(), kind)
+	function.Calls++
+	function.active++
+	p.calls = append(p.calls, profileCall{p.node, p.line, now})
+	p.node = p.node.child(function, profileLine{})
+}
+
+// Called once a function has returned
+func (p *Profiler) exit() {
+	now := p.charge()
+	function := p.node.function
+	call := p.calls[len(p.calls)-1]
+	p.calls = p.calls[:len(p.calls)-1]
+	function.active--
+	if function.active == 0 {
+		function.Total += now.Sub(call.start)
+	}
+	p.node, p.line = call.node, call.line
+}
+
+// Describes how a call to fn is profiled
+func profileKind(fn Callable) ProfileKind {
+	switch fn.(type) {
+	case *LoxClass:
+		return PROFILE_INITIALIZER
+	case *NativeFunction:
+		return PROFILE_NATIVE
+	}
+	return PROFILE_FUNCTION
+}
+
+// Functions lists every function that was called, slowest first by self time
+func (p *Profiler) Functions() []FunctionProfile {
+	functions := make([]FunctionProfile, 0, len(p.functions))
+	for _, function := range p.functions {
+		functions = append(functions, *function)
+	}
+	sort.Slice(functions, func(a, b int) bool {
+		if functions[a].Self != functions[b].Self {
+			return functions[a].Self > functions[b].Self
+		}
+		return functions[a].Name < functions[b].Name
+	})
+	return functions
+}
+
+// Lines lists every line that ran, slowest first
+func (p *Profiler) Lines() []LineProfile {
+	lines := make([]LineProfile, 0, len(p.lines))
+	for _, line := range p.lines {
+		lines = append(lines, *line)
+	}
+	sort.Slice(lines, func(a, b int) bool {
+		if lines[a].Time != lines[b].Time {
+			return lines[a].Time > lines[b].Time
+		}
+		if lines[a].File != lines[b].File {
+			return lines[a].File < lines[b].File
+		}
+		return lines[a].Line < lines[b].Line
+	})
+	return lines
+}
+
+// WriteSummary writes a table of the time spent in each function, followed by
+// the slowest lines
+func (p *Profiler) WriteSummary(w io.Writer) {
+	total := p.script.Total
+	fmt.Fprintf(w, "Total time: %s\n\n", formatDuration(total))
+
+	fmt.Fprintf(w, "%10s %12s %12s %7s  %s\n", "calls", "total", "self", "self%", "function")
+	for _, function := range p.Functions() {
+		fmt.Fprintf(w, "%10d %12s %12s %6.1f%%  %s%s\n", function.Calls, formatDuration(function.Total), formatDuration(function.Self),
+			percentOf(function.Self, total), function.Name, function.Kind.suffix())
+	}
+
+	fmt.Fprintf(w, "\n%10s %12s %7s  %s\n", "count", "time", "time%", "line")
+	for j, line := range p.Lines() {
+		if j == PROFILE_TOP_LINES {
+			break
+		}
+		fmt.Fprintf(w, "%10d %12s %6.1f%%  %s:%d\n", line.Count, formatDuration(line.Time),
+			percentOf(line.Time, total), filepath.Base(line.File), line.Line)
+	}
+}
+
+// WriteFolded writes the time spent in each stack of calls in the folded
+// format read by flame graph tools, with times in nanoseconds:
+//
+//	<script>;main;fib 123456
+func (p *Profiler) WriteFolded(w io.Writer) {
+	stacks := make(map[string]time.Duration)
+	var fold func(node *profileNode, stack string)
+	fold = func(node *profileNode, stack string) {
+		for _, child := range node.children {
+			childStack := joinStack(stack, child.function.Name)
+			stacks[childStack] += child.self
+			fold(child, childStack)
+		}
+	}
+	fold(p.root, "")
+
+	keys := make([]string, 0, len(stacks))
+	for stack, self := range stacks {
+		if self > 0 {
+			keys = append(keys, stack)
+		}
+	}
+	sort.Strings(keys)
+	for _, stack := range keys {
+		fmt.Fprintf(w, "%s %d\n", stack, stacks[stack].Nanoseconds())
+	}
+}
+
+func joinStack(stack string, name string) string {
+	// semicolons and spaces separate the fields of the folded format
+	name = strings.NewReplacer(";", ":", " ", "_").Replace(name)
+	if stack == "" {
+		return name
+	}
+	return stack + ";" + name
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3fms", float64(d.Nanoseconds())/1e6)
+}
+
+func percentOf(d time.Duration, total time.Duration) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return 100 * float64(d) / float64(total)
+}
+
+// Marks natives and initializers in the summary, since their names don't
+// tell them apart from other functions
+func (k ProfileKind) suffix() string {
+	switch k {
+	case PROFILE_NATIVE:
+		return " (native)"
+	case PROFILE_INITIALIZER:
+		return " (initializer)"
+	}
+	return ""
+}
+
+func (k ProfileKind) String() string {
+	switch k {
+	case PROFILE_SCRIPT:
+		return "script"
+	case PROFILE_FUNCTION:
+		return "function"
+	case PROFILE_NATIVE:
+		return "native"
+	case PROFILE_INITIALIZER:
+		return "initializer"
+	case PROFILE_MODULE:
+		return "module"
+	}
+	return fmt.Sprintf("ProfileKind(%d)", k)
+}
@@ -1,6 +1,8 @@
 package ast
 
-import "github.com/faideww/glox/src/errors"
+import (
+	"github.com/faideww/glox/src/token"
+)
 
 type Resolvable interface {
 	Resolve(r *Resolver) error
@@ -8,18 +10,17 @@ type Resolvable interface {
 
 func (bs BlockStmt) Resolve(r *Resolver) error {
 	r.beginScope()
-	for _, stmt := range bs.statements {
-		err := stmt.(Resolvable).Resolve(r)
-		if err != nil {
-			return err
-		}
+	err := r.resolveStatements(bs.statements)
+	if err != nil {
+		return err
 	}
-	return r.endScope()
+	r.endScope()
+	return nil
 }
 
 func (bs BreakStmt) Resolve(r *Resolver) error {
 	if !r.inLoop {
-		return errors.NewAnalysisError(bs.token, "Can't break outside of loop")
+		r.error(bs.token, "Can't break outside of loop")
 	}
 	return nil
 }
@@ -28,16 +29,24 @@ func (cs ClassStmt) Resolve(r *Resolver) error {
 	enclosingClass := r.currentClass
 	defer func() { r.currentClass = enclosingClass }()
 	r.currentClass = CLASSTYPE_CLASS
-	err := r.declare(cs.name)
-	if err != nil {
-		return err
-	}
+	classSymbol := r.declare(cs.name, SYMBOL_CLASS)
 	r.define(cs.name)
 
+	superclassName := ""
+	if cs.superclass != nil {
+		superclassName = cs.superclass.name.Lexeme
+	}
+	r.index.enter(classSymbol)
+	r.index.enterClass(cs.name.Lexeme, superclassName)
+	defer func() {
+		r.index.exitClass()
+		r.index.exit(classSymbol)
+	}()
+
 	if cs.superclass != nil {
 
 		if cs.name.Lexeme == cs.superclass.name.Lexeme {
-			return errors.NewAnalysisError(cs.superclass.name, "A class can't inherit from itself")
+			r.error(cs.superclass.name, "A class can't inherit from itself")
 		}
 		r.currentClass = CLASSTYPE_SUBCLASS
 		superclassErr := cs.superclass.Resolve(r)
@@ -68,21 +77,18 @@ func (cs ClassStmt) Resolve(r *Resolver) error {
 		if method.name.Lexeme == "init" {
 			declaration = FNTYPE_INITIALIZER
 		}
-		fnErr := resolveFunction(r, method, declaration)
+		methodSymbol := r.index.declareMethod(method.name, cs.name.Lexeme)
+		r.index.enter(methodSymbol)
+		fnErr := resolveFunction(r, method.params, method.body, declaration)
+		r.index.exit(methodSymbol)
 		if fnErr != nil {
 			return fnErr
 		}
 	}
-	err = r.endScope()
-	if err != nil {
-		return err
-	}
+	r.endScope()
 
 	if cs.superclass != nil {
-		err = r.endScope()
-		if err != nil {
-			return err
-		}
+		r.endScope()
 	}
 
 	return nil
@@ -90,7 +96,7 @@ func (cs ClassStmt) Resolve(r *Resolver) error {
 
 func (cs ContinueStmt) Resolve(r *Resolver) error {
 	if !r.inLoop {
-		return errors.NewAnalysisError(cs.token, "Can't continue outside of loop")
+		r.error(cs.token, "Can't continue outside of loop")
 	}
 	return nil
 }
@@ -99,36 +105,41 @@ func (es ExpressionStmt) Resolve(r *Resolver) error {
 	return es.expression.(Resolvable).Resolve(r)
 }
 
+func (fs ForStmt) Resolve(r *Resolver) error {
+	return fs.loop.(Resolvable).Resolve(r)
+}
+
 func (fs FunctionStmt) Resolve(r *Resolver) error {
-	err := r.declare(fs.name)
-	if err != nil {
-		return err
-	}
+	symbol := r.declare(fs.name, SYMBOL_FUNCTION)
 	r.define(fs.name)
 
-	return resolveFunction(r, fs, FNTYPE_FUNCTION)
+	r.index.enter(symbol)
+	defer r.index.exit(symbol)
+	return resolveFunction(r, fs.params, fs.body, FNTYPE_FUNCTION)
 }
 
-func resolveFunction(r *Resolver, fs FunctionStmt, fnType FunctionType) error {
+func resolveFunction(r *Resolver, params []token.Token, body []Stmt, fnType FunctionType) error {
 	enclosingFn := r.currentFunction
 	r.currentFunction = fnType
-	defer func() { r.currentFunction = enclosingFn }()
+	// a function body is never directly inside a loop, even if the function
+	// itself is declared in one
+	enclosingInLoop := r.inLoop
+	r.inLoop = false
+	defer func() {
+		r.currentFunction = enclosingFn
+		r.inLoop = enclosingInLoop
+	}()
 	r.beginScope()
-	for _, param := range fs.params {
-		err := r.declare(param)
-		if err != nil {
-			return err
-		}
+	for _, param := range params {
+		r.declare(param, SYMBOL_PARAMETER)
 		r.define(param)
 	}
-	for _, stmt := range fs.body {
-		err := stmt.(Resolvable).Resolve(r)
-		if err != nil {
-			return err
-		}
+	err := r.resolveStatements(body)
+	if err != nil {
+		return err
 	}
-	err := r.endScope()
-	return err
+	r.endScope()
+	return nil
 }
 
 func (is IfStmt) Resolve(r *Resolver) error {
@@ -150,28 +161,58 @@ func (is IfStmt) Resolve(r *Resolver) error {
 	return nil
 }
 
+func (is ImportStmt) Resolve(r *Resolver) error {
+	r.declare(is.name, SYMBOL_IMPORT)
+	r.define(is.name)
+	return nil
+}
+
 func (ps PrintStmt) Resolve(r *Resolver) error {
 	return ps.expression.(Resolvable).Resolve(r)
 }
 
 func (rs ReturnStmt) Resolve(r *Resolver) error {
 	if r.currentFunction == FNTYPE_NONE {
-		return errors.NewAnalysisError(rs.keyword, "Can't return from top-level code")
+		r.error(rs.keyword, "Can't return from top-level code")
 	}
 	if rs.value != nil {
 		if r.currentFunction == FNTYPE_INITIALIZER {
-			return errors.NewAnalysisError(rs.keyword, "Can't return a value from a class initializer")
+			r.error(rs.keyword, "Can't return a value from a class initializer")
 		}
 		return rs.value.(Resolvable).Resolve(r)
 	}
 	return nil
 }
 
-func (vs VarStmt) Resolve(r *Resolver) error {
-	err := r.declare(vs.name)
+func (ts ThrowStmt) Resolve(r *Resolver) error {
+	return ts.value.(Resolvable).Resolve(r)
+}
+
+func (ts TryStmt) Resolve(r *Resolver) error {
+	err := ts.body.Resolve(r)
 	if err != nil {
 		return err
 	}
+
+	if ts.catchBlock != nil {
+		r.beginScope()
+		r.declare(ts.catchParam, SYMBOL_VARIABLE)
+		r.define(ts.catchParam)
+		err = ts.catchBlock.Resolve(r)
+		if err != nil {
+			return err
+		}
+		r.endScope()
+	}
+
+	if ts.finallyBlock != nil {
+		return ts.finallyBlock.Resolve(r)
+	}
+	return nil
+}
+
+func (vs VarStmt) Resolve(r *Resolver) error {
+	r.declare(vs.name, SYMBOL_VARIABLE)
 	if vs.initializer != nil {
 		err := vs.initializer.(Resolvable).Resolve(r)
 		if err != nil {
@@ -192,7 +233,10 @@ func (ws WhileStmt) Resolve(r *Resolver) error {
 	r.inLoop = true
 	err = ws.body.(Resolvable).Resolve(r)
 	r.inLoop = prevInLoop
-	return err
+	if err != nil || ws.increment == nil {
+		return err
+	}
+	return ws.increment.(Resolvable).Resolve(r)
 }
 
 func (a AssignmentExpr) Resolve(r *Resolver) error {
@@ -200,7 +244,7 @@ func (a AssignmentExpr) Resolve(r *Resolver) error {
 	if err != nil {
 		return err
 	}
-	r.resolveLocal(a, a.name)
+	r.resolveLocal(a.name)
 	return nil
 }
 
@@ -230,7 +274,12 @@ func (c CallExpr) Resolve(r *Resolver) error {
 	return nil
 }
 
+func (f FunctionExpr) Resolve(r *Resolver) error {
+	return resolveFunction(r, f.params, f.body, FNTYPE_FUNCTION)
+}
+
 func (g GetExpr) Resolve(r *Resolver) error {
+	r.index.member(g.name, g.object)
 	return g.object.(Resolvable).Resolve(r)
 }
 
@@ -238,6 +287,36 @@ func (g GroupingExpr) Resolve(r *Resolver) error {
 	return g.expression.(Resolvable).Resolve(r)
 }
 
+func (ie IndexExpr) Resolve(r *Resolver) error {
+	err := ie.object.(Resolvable).Resolve(r)
+	if err != nil {
+		return err
+	}
+	return ie.index.(Resolvable).Resolve(r)
+}
+
+func (is IndexSetExpr) Resolve(r *Resolver) error {
+	err := is.object.(Resolvable).Resolve(r)
+	if err != nil {
+		return err
+	}
+	err = is.index.(Resolvable).Resolve(r)
+	if err != nil {
+		return err
+	}
+	return is.value.(Resolvable).Resolve(r)
+}
+
+func (l ListExpr) Resolve(r *Resolver) error {
+	for _, element := range l.elements {
+		err := element.(Resolvable).Resolve(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (l LiteralExpr) Resolve(r *Resolver) error {
 	return nil
 }
@@ -254,7 +333,22 @@ func (l LogicalExpr) Resolve(r *Resolver) error {
 	return nil
 }
 
+func (m MapExpr) Resolve(r *Resolver) error {
+	for j := range m.keys {
+		err := m.keys[j].(Resolvable).Resolve(r)
+		if err != nil {
+			return err
+		}
+		err = m.values[j].(Resolvable).Resolve(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s SetExpr) Resolve(r *Resolver) error {
+	r.index.member(s.name, s.obj)
 	err := s.value.(Resolvable).Resolve(r)
 	if err != nil {
 		return err
@@ -268,11 +362,14 @@ func (s SetExpr) Resolve(r *Resolver) error {
 
 func (s SuperExpr) Resolve(r *Resolver) error {
 	if r.currentClass == CLASSTYPE_NONE {
-		return errors.NewAnalysisError(s.keyword, "Can't use 'super' outside of a class")
+		r.error(s.keyword, "Can't use 'super' outside of a class")
+		return nil
 	} else if r.currentClass != CLASSTYPE_SUBCLASS {
-		return errors.NewAnalysisError(s.keyword, "Can't use 'super' in a class with no superclass")
+		r.error(s.keyword, "Can't use 'super' in a class with no superclass")
+		return nil
 	}
-	r.resolveLocal(s, s.keyword)
+	r.index.member(s.method, s)
+	r.resolveLocal(s.keyword)
 	return nil
 }
 
@@ -295,9 +392,10 @@ func (t TernaryExpr) Resolve(r *Resolver) error {
 
 func (t ThisExpr) Resolve(r *Resolver) error {
 	if r.currentClass == CLASSTYPE_NONE {
-		return errors.NewAnalysisError(t.keyword, "Can't use 'this' outside of a class")
+		r.error(t.keyword, "Can't use 'this' outside of a class")
+		return nil
 	}
-	r.resolveLocal(t, t.keyword)
+	r.resolveLocal(t.keyword)
 	return nil
 }
 
@@ -313,10 +411,10 @@ func (v VariableExpr) Resolve(r *Resolver) error {
 	if len(r.scopes) > 0 {
 		def, ok := r.scopes[len(r.scopes)-1][v.name.Lexeme]
 		if ok && !def.defined {
-			return errors.NewAnalysisError(v.name, "Can't read local variable in its own initializer")
+			r.error(v.name, "Can't read local variable in its own initializer")
 		}
 	}
 
-	r.resolveLocal(v, v.name)
+	r.resolveLocal(v.name)
 	return nil
 }
@@ -12,6 +12,7 @@ type ScopeVariable struct {
 	name        string
 	defined     bool
 	used        bool
+	symbol      *Symbol
 }
 
 type Scope map[string]ScopeVariable
@@ -39,58 +40,138 @@ type Resolver struct {
 	currentFunction FunctionType
 	inLoop          bool
 	currentClass    ClassType
+	reporter        *errors.ErrorReporter
+	index           *SymbolIndex
+	// where each global declared so far was first declared, so that locals
+	// shadowing them can be warned about
+	globals map[string]token.Token
 }
 
-func NewResolver(interpreter *Interpreter) *Resolver {
+func NewResolver(interpreter *Interpreter, reporter *errors.ErrorReporter) *Resolver {
 	return &Resolver{
 		interpreter:     interpreter,
+		reporter:        reporter,
 		scopes:          make([]Scope, 0),
 		currentFunction: FNTYPE_NONE,
 		inLoop:          false,
 		currentClass:    CLASSTYPE_NONE,
+		globals:         make(map[string]token.Token),
 	}
 }
 
-func (r *Resolver) Resolve(statements []Stmt) error {
+// SetSymbolIndex makes the resolver record every declaration and reference it
+// sees into index
+func (r *Resolver) SetSymbolIndex(index *SymbolIndex) {
+	r.index = index
+}
+
+// Resolve reports every problem it finds in statements, rather than stopping at
+// the first, and returns false if any of them were errors. Warnings don't stop
+// the program from running.
+func (r *Resolver) Resolve(statements []Stmt) bool {
 	for _, statement := range statements {
 		err := statement.(Resolvable).Resolve(r)
+		if err != nil {
+			r.reporter.Collect(err)
+		}
+	}
+	r.index.link()
+	return !r.reporter.HasErrors()
+}
+
+// ResolveExpression resolves an expression that is evaluated on its own, outside
+// of any statement
+func (r *Resolver) ResolveExpression(expr Expr) bool {
+	err := expr.(Resolvable).Resolve(r)
+	if err != nil {
+		r.reporter.Collect(err)
+	}
+	r.index.link()
+	return !r.reporter.HasErrors()
+}
+
+// Records a problem with the program. Resolution carries on afterwards, since
+// none of these problems prevent the rest of the program from being checked.
+func (r *Resolver) error(t token.Token, message string) {
+	r.reporter.Collect(errors.NewAnalysisError(t, message))
+}
+
+func (r *Resolver) warn(kind errors.WarningKind, t token.Token, message string) *errors.AnalysisError {
+	warning := errors.NewAnalysisWarning(t, kind, message)
+	r.reporter.Collect(warning)
+	return warning
+}
+
+// Resolves a list of statements, warning about any that follow a statement
+// which always jumps out of the list
+func (r *Resolver) resolveStatements(statements []Stmt) error {
+	for j, stmt := range statements {
+		err := stmt.(Resolvable).Resolve(r)
 		if err != nil {
 			return err
 		}
+
+		if keyword, ok := jumpKeyword(stmt); ok && j < len(statements)-1 {
+			r.warn(errors.WARN_UNREACHABLE, keyword, fmt.Sprintf("Unreachable code after '%s'", keyword.Lexeme))
+		}
 	}
 	return nil
 }
 
+// Returns the keyword of statements that unconditionally jump elsewhere
+func jumpKeyword(stmt Stmt) (token.Token, bool) {
+	switch stmt := stmt.(type) {
+	case ReturnStmt:
+		return stmt.keyword, true
+	case BreakStmt:
+		return stmt.token, true
+	case ContinueStmt:
+		return stmt.token, true
+	case ThrowStmt:
+		return stmt.keyword, true
+	}
+	return token.Token{}, false
+}
+
 func (r *Resolver) beginScope() {
 	r.scopes = append(r.scopes, make(Scope))
 }
 
-func (r *Resolver) endScope() error {
+func (r *Resolver) endScope() {
 
 	// scan for unused variables
 	scope := r.scopes[len(r.scopes)-1]
 	for _, v := range scope {
 		if !v.used {
-			return errors.NewAnalysisError(*v.declaration, fmt.Sprintf("Unused variable '%s'", v.name))
+			r.warn(errors.WARN_UNUSED, *v.declaration, fmt.Sprintf("Unused variable '%s'", v.name))
 		}
 	}
 
 	// TODO: this will panic if we try to end a scope when we have none to end. Do we want that,
 	// or should we silently ignore/log an error and recover?
 	r.scopes = r.scopes[:len(r.scopes)-1]
-	return nil
 }
 
-func (r *Resolver) declare(name token.Token) error {
+func (r *Resolver) declare(name token.Token, kind SymbolKind) *Symbol {
+	symbol := r.index.declare(name, kind, len(r.scopes) > 0)
 	if len(r.scopes) == 0 {
-		return nil
+		// globals may be redeclared, so only the first declaration is kept
+		if _, ok := r.globals[name.Lexeme]; !ok {
+			r.globals[name.Lexeme] = name
+		}
+		return symbol
 	}
 
 	currentScope := r.scopes[len(r.scopes)-1]
 
 	if _, ok := currentScope[name.Lexeme]; ok {
-		errStr := fmt.Sprintf("Variable '%s' already exists in this scope", name.Lexeme)
-		return errors.NewAnalysisError(name, errStr)
+		r.error(name, fmt.Sprintf("Variable '%s' already exists in this scope", name.Lexeme))
+		return symbol
+	}
+
+	if outer, ok := r.shadowed(name.Lexeme); ok {
+		warning := r.warn(errors.WARN_SHADOW, name, fmt.Sprintf("Variable '%s' shadows a variable in an enclosing scope", name.Lexeme))
+		warning.AddNote(outer, fmt.Sprintf("'%s' was declared here", name.Lexeme))
 	}
 
 	currentScope[name.Lexeme] = ScopeVariable{
@@ -98,8 +179,21 @@ func (r *Resolver) declare(name token.Token) error {
 		name:        name.Lexeme,
 		defined:     false,
 		used:        false,
+		symbol:      symbol,
 	}
-	return nil
+	return symbol
+}
+
+// Finds the declaration of the variable a new local called name would shadow,
+// looking through the enclosing scopes and then the globals declared before it
+func (r *Resolver) shadowed(name string) (token.Token, bool) {
+	for i := len(r.scopes) - 2; i >= 0; i-- {
+		if outer, ok := r.scopes[i][name]; ok && outer.declaration != nil {
+			return *outer.declaration, true
+		}
+	}
+	declaration, ok := r.globals[name]
+	return declaration, ok
 }
 
 func (r *Resolver) define(name token.Token) {
@@ -116,15 +210,20 @@ func (r *Resolver) define(name token.Token) {
 // Walk back up the scope stack to find the nearest enclosing scope defining
 // the provided variable name, then pass the depth to the interpreter so it can
 // resolve its value later during runtime
-func (r *Resolver) resolveLocal(expr Expr, name token.Token) {
+func (r *Resolver) resolveLocal(name token.Token) {
 	for i := len(r.scopes) - 1; i >= 0; i-- {
 		if v, ok := r.scopes[i][name.Lexeme]; ok {
-			r.interpreter.resolve(expr, len(r.scopes)-1-i)
+			r.interpreter.resolve(name, len(r.scopes)-1-i)
 
 			v.used = true
 			r.scopes[i][name.Lexeme] = v
 
+			if name.TokenType == token.IDENTIFIER {
+				r.index.reference(name, v.symbol)
+			}
 			return
 		}
 	}
+
+	r.index.reference(name, nil)
 }
@@ -0,0 +1,37 @@
+package ast_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/faideww/glox/src/glox"
+)
+
+func TestShadowWarnings(t *testing.T) {
+	cases := []struct {
+		source string
+		shadow bool
+	}{
+		{"{ var a = 1; { var a = 2; print a; } print a; }", true},
+		{"var a = 1; { var a = 2; print a; }", true},
+		{"var a = 1; fun f(a) { return a; }", true},
+		{"var a = 1; class A { m() { var a = 2; return a; } }", true},
+		// a global declared later isn't visible when the local is declared
+		{"fun f() { var a = 2; return a; } var a = 1;", false},
+		{"{ var a = 1; print a; } { var a = 2; print a; }", false},
+		{"var a = 1; var a = 2;", false},
+	}
+	for _, c := range cases {
+		var diagnostics bytes.Buffer
+		l := glox.New(glox.WithDiagnostics(&diagnostics))
+		if err := l.Run(c.source, "shadow.lox"); err != nil {
+			t.Errorf("%s: %s", c.source, err)
+			continue
+		}
+		shadow := strings.Contains(diagnostics.String(), "[-Wshadow]")
+		if shadow != c.shadow {
+			t.Errorf("%s: shadow warning = %v, want %v:\n%s", c.source, shadow, c.shadow, diagnostics.String())
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A NamespaceFactory builds the members of a standard library namespace, such
+// as math or str. Each interpreter calls the factory once when it is created.
+type NamespaceFactory func() map[string]*NativeFunction
+
+var namespaceRegistry = map[string]NamespaceFactory{
+	"io":   ioNamespace,
+	"math": mathNamespace,
+	"os":   osNamespace,
+	"str":  strNamespace,
+}
+
+// RegisterNamespace makes a namespace of natives available to interpreters
+// created afterwards. Registering an existing name replaces it.
+func RegisterNamespace(name string, factory NamespaceFactory) {
+	namespaceRegistry[name] = factory
+}
+
+// RegisteredNamespaces lists the names of every registered namespace, in
+// alphabetical order
+func RegisteredNamespaces() []string {
+	names := make([]string, 0, len(namespaceRegistry))
+	for name := range namespaceRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Defines each of the given namespaces in the builtins environment. Unknown
+// names are ignored, so that embedders can share one configuration across
+// builds with different namespaces registered.
+func defineNamespaces(builtins *Environment, names []string) {
+	for _, name := range names {
+		factory, ok := namespaceRegistry[name]
+		if !ok {
+			continue
+		}
+
+		namespace := NewLoxModule(name, builtins)
+		for member, fn := range factory() {
+			fn.name = fmt.Sprintf("%s.%s", name, member)
+			namespace.globals.Define(member, fn)
+		}
+		builtins.Define(name, namespace)
+	}
+}
+
+func stringArg(fnName string, args []LoxValue, j int) (string, error) {
+	s, ok := args[j].(string)
+	if !ok {
+		return "", NewNativeError(fmt.Sprintf("%s() expects argument %d to be a string", fnName, j+1))
+	}
+	return s, nil
+}
+
+func numberArg(fnName string, args []LoxValue, j int) (float64, error) {
+	n, ok := args[j].(float64)
+	if !ok {
+		return 0, NewNativeError(fmt.Sprintf("%s() expects argument %d to be a number", fnName, j+1))
+	}
+	return n, nil
+}
@@ -6,6 +6,7 @@ type Stmt interface {
 }
 
 type BlockStmt struct {
+	brace      token.Token
 	statements []Stmt
 }
 
@@ -23,6 +24,17 @@ type ExpressionStmt struct {
 	expression Expr
 }
 
+// ForStmt keeps the clauses of a for loop as they were written, for tools that
+// print the program back out. It runs as the equivalent while loop.
+type ForStmt struct {
+	keyword     token.Token
+	initializer Stmt
+	condition   Expr
+	increment   Expr
+	body        Stmt
+	loop        Stmt
+}
+
 type FunctionStmt struct {
 	name   token.Token
 	params []token.Token
@@ -30,12 +42,20 @@ type FunctionStmt struct {
 }
 
 type IfStmt struct {
+	keyword    token.Token
 	condition  Expr
 	thenBranch Stmt
 	elseBranch Stmt
 }
 
+type ImportStmt struct {
+	keyword token.Token
+	path    token.Token
+	name    token.Token
+}
+
 type PrintStmt struct {
+	keyword    token.Token
 	expression Expr
 }
 
@@ -44,12 +64,73 @@ type ReturnStmt struct {
 	value   Expr
 }
 
+type ThrowStmt struct {
+	keyword token.Token
+	value   Expr
+}
+
+type TryStmt struct {
+	keyword      token.Token
+	body         BlockStmt
+	catchParam   token.Token
+	catchBlock   *BlockStmt
+	finallyBlock *BlockStmt
+}
+
 type VarStmt struct {
+	keyword     token.Token
 	name        token.Token
 	initializer Expr
 }
 
 type WhileStmt struct {
+	keyword   token.Token
 	condition Expr
 	body      Stmt
+	// increment is the increment clause of the for loop the while loop was
+	// desugared from, if any. It runs after each iteration, including those
+	// ended by continue.
+	increment Stmt
+}
+
+// stmtToken returns a token that a statement can be reported at, usually its
+// keyword
+func stmtToken(stmt Stmt) token.Token {
+	switch stmt := stmt.(type) {
+	case BlockStmt:
+		// blocks made up by desugaring have no brace of their own
+		if stmt.brace.Line == 0 && len(stmt.statements) > 0 {
+			return stmtToken(stmt.statements[0])
+		}
+		return stmt.brace
+	case BreakStmt:
+		return stmt.token
+	case ClassStmt:
+		return stmt.name
+	case ContinueStmt:
+		return stmt.token
+	case ExpressionStmt:
+		return exprToken(stmt.expression)
+	case ForStmt:
+		return stmt.keyword
+	case FunctionStmt:
+		return stmt.name
+	case IfStmt:
+		return stmt.keyword
+	case ImportStmt:
+		return stmt.keyword
+	case PrintStmt:
+		return stmt.keyword
+	case ReturnStmt:
+		return stmt.keyword
+	case ThrowStmt:
+		return stmt.keyword
+	case TryStmt:
+		return stmt.keyword
+	case VarStmt:
+		return stmt.keyword
+	case WhileStmt:
+		return stmt.keyword
+	}
+	return token.Token{}
 }
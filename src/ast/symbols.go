@@ -0,0 +1,278 @@
+package ast
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/faideww/glox/src/token"
+)
+
+type SymbolKind int
+
+const (
+	SYMBOL_VARIABLE = iota
+	SYMBOL_PARAMETER
+	SYMBOL_FUNCTION
+	SYMBOL_CLASS
+	SYMBOL_METHOD
+	SYMBOL_IMPORT
+)
+
+var symbolKindNames = map[SymbolKind]string{
+	SYMBOL_VARIABLE:  "variable",
+	SYMBOL_PARAMETER: "parameter",
+	SYMBOL_FUNCTION:  "function",
+	SYMBOL_CLASS:     "class",
+	SYMBOL_METHOD:    "method",
+	SYMBOL_IMPORT:    "module",
+}
+
+func (k SymbolKind) String() string {
+	return symbolKindNames[k]
+}
+
+type SymbolScope int
+
+const (
+	SCOPE_GLOBAL = iota
+	SCOPE_LOCAL
+	SCOPE_MEMBER
+)
+
+// A Symbol is a single declaration of a name: a variable, parameter, function,
+// class, method or imported module
+type Symbol struct {
+	Name  token.Token
+	Kind  SymbolKind
+	Scope SymbolScope
+	// Class is the class that declares a method
+	Class string
+	// Children are the functions, classes and methods declared inside a
+	// function or class, for building an outline of the file
+	Children []*Symbol
+}
+
+// Describe summarises the symbol for display, such as "(local variable) x"
+func (s *Symbol) Describe() string {
+	switch s.Scope {
+	case SCOPE_MEMBER:
+		return fmt.Sprintf("(class member) %s.%s", s.Class, s.Name.Lexeme)
+	case SCOPE_LOCAL:
+		if s.Kind == SYMBOL_PARAMETER {
+			return fmt.Sprintf("(parameter) %s", s.Name.Lexeme)
+		}
+		return fmt.Sprintf("(local %s) %s", s.Kind, s.Name.Lexeme)
+	}
+	return fmt.Sprintf("(global %s) %s", s.Kind, s.Name.Lexeme)
+}
+
+// A Reference is a use of a name. Property accesses can't be resolved to a
+// particular class in general, so member references are linked to every
+// method with the same name unless the class is known.
+type Reference struct {
+	Name   token.Token
+	Symbol *Symbol
+	Member bool
+	Class  string
+}
+
+type classContext struct {
+	name       string
+	superclass string
+}
+
+// A SymbolIndex records every declaration and reference that the resolver
+// sees, for editor tooling. It is filled in by a Resolver that has been given
+// one with SetSymbolIndex.
+type SymbolIndex struct {
+	Symbols    []*Symbol
+	References []*Reference
+	outline    []*Symbol
+	globals    map[string]*Symbol
+	methods    map[string][]*Symbol
+	containers []*Symbol
+	classes    []classContext
+}
+
+func NewSymbolIndex() *SymbolIndex {
+	return &SymbolIndex{
+		Symbols:    make([]*Symbol, 0),
+		References: make([]*Reference, 0),
+		outline:    make([]*Symbol, 0),
+		globals:    make(map[string]*Symbol),
+		methods:    make(map[string][]*Symbol),
+	}
+}
+
+// Outline returns the classes, methods and functions declared in the file,
+// with nested declarations as children of the symbol that contains them
+func (x *SymbolIndex) Outline() []*Symbol {
+	return x.outline
+}
+
+// The methods below are called by the resolver, which may not have an index,
+// so they all accept a nil receiver
+
+func (x *SymbolIndex) declare(name token.Token, kind SymbolKind, local bool) *Symbol {
+	if x == nil {
+		return nil
+	}
+
+	symbol := &Symbol{Name: name, Kind: kind, Scope: SCOPE_GLOBAL}
+	if local {
+		symbol.Scope = SCOPE_LOCAL
+	} else if _, ok := x.globals[name.Lexeme]; !ok {
+		x.globals[name.Lexeme] = symbol
+	}
+	x.add(symbol)
+	return symbol
+}
+
+func (x *SymbolIndex) declareMethod(name token.Token, class string) *Symbol {
+	if x == nil {
+		return nil
+	}
+
+	symbol := &Symbol{Name: name, Kind: SYMBOL_METHOD, Scope: SCOPE_MEMBER, Class: class}
+	x.methods[name.Lexeme] = append(x.methods[name.Lexeme], symbol)
+	x.add(symbol)
+	return symbol
+}
+
+func (x *SymbolIndex) add(symbol *Symbol) {
+	x.Symbols = append(x.Symbols, symbol)
+
+	if symbol.Kind != SYMBOL_FUNCTION && symbol.Kind != SYMBOL_CLASS && symbol.Kind != SYMBOL_METHOD {
+		return
+	}
+	if len(x.containers) > 0 {
+		parent := x.containers[len(x.containers)-1]
+		parent.Children = append(parent.Children, symbol)
+	} else {
+		x.outline = append(x.outline, symbol)
+	}
+}
+
+// enter makes symbol the parent of declarations that follow, until exit
+func (x *SymbolIndex) enter(symbol *Symbol) {
+	if x == nil || symbol == nil {
+		return
+	}
+	x.containers = append(x.containers, symbol)
+}
+
+func (x *SymbolIndex) exit(symbol *Symbol) {
+	if x == nil || symbol == nil {
+		return
+	}
+	x.containers = x.containers[:len(x.containers)-1]
+}
+
+func (x *SymbolIndex) enterClass(name string, superclass string) {
+	if x == nil {
+		return
+	}
+	x.classes = append(x.classes, classContext{name, superclass})
+}
+
+func (x *SymbolIndex) exitClass() {
+	if x == nil {
+		return
+	}
+	x.classes = x.classes[:len(x.classes)-1]
+}
+
+// reference records a use of a variable. A nil symbol means that the name
+// wasn't found in any local scope, so it refers to a global that may be
+// declared later in the file.
+func (x *SymbolIndex) reference(name token.Token, symbol *Symbol) {
+	if x == nil {
+		return
+	}
+	x.References = append(x.References, &Reference{Name: name, Symbol: symbol})
+}
+
+// member records a property access. Accesses on this and super are known to
+// refer to the enclosing class and its superclass.
+func (x *SymbolIndex) member(name token.Token, object Expr) {
+	if x == nil {
+		return
+	}
+
+	ref := &Reference{Name: name, Member: true}
+	if len(x.classes) > 0 {
+		switch object.(type) {
+		case ThisExpr:
+			ref.Class = x.classes[len(x.classes)-1].name
+		case SuperExpr:
+			ref.Class = x.classes[len(x.classes)-1].superclass
+		}
+	}
+	x.References = append(x.References, ref)
+}
+
+// link resolves references to globals once every global has been seen
+func (x *SymbolIndex) link() {
+	if x == nil {
+		return
+	}
+	for _, ref := range x.References {
+		if ref.Symbol == nil && !ref.Member {
+			ref.Symbol = x.globals[ref.Name.Lexeme]
+		}
+	}
+}
+
+// Definitions returns the declarations a reference may refer to
+func (x *SymbolIndex) Definitions(ref *Reference) []*Symbol {
+	if !ref.Member {
+		if ref.Symbol == nil {
+			return nil
+		}
+		return []*Symbol{ref.Symbol}
+	}
+
+	candidates := x.methods[ref.Name.Lexeme]
+	if ref.Class != "" {
+		for _, method := range candidates {
+			if method.Class == ref.Class {
+				return []*Symbol{method}
+			}
+		}
+	}
+	return candidates
+}
+
+// ReferencesTo returns every reference that may refer to symbol
+func (x *SymbolIndex) ReferencesTo(symbol *Symbol) []*Reference {
+	refs := make([]*Reference, 0)
+	for _, ref := range x.References {
+		for _, definition := range x.Definitions(ref) {
+			if definition == symbol {
+				refs = append(refs, ref)
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// At finds the declaration or reference whose name covers the given 1-based
+// line and column. Exactly one of the results is non-nil if anything is found.
+func (x *SymbolIndex) At(line int, column int) (*Symbol, *Reference) {
+	for _, symbol := range x.Symbols {
+		if covers(symbol.Name, line, column) {
+			return symbol, nil
+		}
+	}
+	for _, ref := range x.References {
+		if covers(ref.Name, line, column) {
+			return nil, ref
+		}
+	}
+	return nil, nil
+}
+
+func covers(t token.Token, line int, column int) bool {
+	return t.Line == line && column >= t.Column && column < t.Column+utf8.RuneCountInString(t.Lexeme)
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/scanner"
+)
+
+// This file implements `glox dap`, a Debug Adapter Protocol server that speaks
+// over stdin and stdout. The program being debugged runs on its own goroutine,
+// which blocks inside the debugger's pause handler while it is stopped; the
+// requests that inspect it are answered from the main loop in the meantime.
+
+// DAP_THREAD_ID identifies the only thread a Lox program has
+const DAP_THREAD_ID = 1
+
+type dapMessage struct {
+	Seq     int    `json:"seq"`
+	Type    string `json:"type"`
+	Command string `json:"command,omitempty"`
+	Event   string `json:"event,omitempty"`
+	// for responses
+	RequestSeq int         `json:"request_seq,omitempty"`
+	Success    *bool       `json:"success,omitempty"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+	// for requests
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dapBreakpoint struct {
+	Line int `json:"line"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dapServer struct {
+	reader *bufio.Reader
+	writer io.Writer
+	// sending is locked, since the program's goroutine sends events too
+	sendLock sync.Mutex
+	seq      int
+
+	debugger   *ast.Debugger
+	program    []ast.Stmt
+	launched   bool
+	configured bool
+	// entry is set until the program first stops, if it stops on entry
+	entry  bool
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// pause is set while the program is stopped, and resume carries on with it
+	pauseLock sync.Mutex
+	pause     *ast.Pause
+	resume    chan ast.StepMode
+	stopped   bool
+	// variables maps each variablesReference handed out since the program
+	// last stopped to the variables it expands to
+	variables [][]ast.DebugVariable
+}
+
+func runDap(r io.Reader, w io.Writer) error {
+	server := &dapServer{
+		reader: bufio.NewReader(r),
+		writer: w,
+		resume: make(chan ast.StepMode),
+	}
+	server.debugger = ast.NewDebugger(server.paused)
+	return server.serve()
+}
+
+func (s *dapServer) serve() error {
+	defer s.stop()
+	for {
+		body, err := readMessage(s.reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var msg dapMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+		if msg.Type != "request" {
+			continue
+		}
+
+		s.handle(msg)
+		if msg.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+func (s *dapServer) send(msg dapMessage) {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	s.seq++
+	msg.Seq = s.seq
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	writeMessage(s.writer, body)
+}
+
+func (s *dapServer) reply(request dapMessage, body interface{}, err error) {
+	success := err == nil
+	msg := dapMessage{Type: "response", Command: request.Command, RequestSeq: request.Seq, Success: &success, Body: body}
+	if err != nil {
+		msg.Message = err.Error()
+	}
+	s.send(msg)
+}
+
+func (s *dapServer) event(event string, body interface{}) {
+	s.send(dapMessage{Type: "event", Event: event, Body: body})
+}
+
+// output sends text for the client to show in its debug console
+func (s *dapServer) output(category string, text string) {
+	s.event("output", map[string]string{"category": category, "output": text})
+}
+
+// A dapOutput forwards what the program prints to the client
+type dapOutput struct {
+	server   *dapServer
+	category string
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	o.server.output(o.category, string(p))
+	return len(p), nil
+}
+
+func (s *dapServer) handle(msg dapMessage) {
+	var body interface{}
+	var err error
+	resume, resuming := ast.STEP_CONTINUE, false
+
+	switch msg.Command {
+	case "initialize":
+		body = map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		}
+	case "launch":
+		var args struct {
+			Program     string   `json:"program"`
+			Args        []string `json:"args"`
+			StopOnEntry bool     `json:"stopOnEntry"`
+		}
+		if err = decodeArguments(msg.Arguments, &args); err == nil {
+			err = s.launch(args.Program, args.Args, args.StopOnEntry)
+		}
+	case "setBreakpoints":
+		var args struct {
+			Source      dapSource       `json:"source"`
+			Breakpoints []dapBreakpoint `json:"breakpoints"`
+		}
+		if err = decodeArguments(msg.Arguments, &args); err == nil {
+			body = s.setBreakpoints(args.Source.Path, args.Breakpoints)
+		}
+	case "configurationDone":
+		s.configured = true
+	case "threads":
+		body = map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": DAP_THREAD_ID, "name": "main"}},
+		}
+	case "stackTrace":
+		body, err = s.stackTrace()
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err = decodeArguments(msg.Arguments, &args); err == nil {
+			body, err = s.scopes(args.FrameID)
+		}
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err = decodeArguments(msg.Arguments, &args); err == nil {
+			body, err = s.expand(args.VariablesReference)
+		}
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+			FrameID    int    `json:"frameId"`
+		}
+		if err = decodeArguments(msg.Arguments, &args); err == nil {
+			body, err = s.evaluate(args.Expression, args.FrameID)
+		}
+	case "continue":
+		body = map[string]bool{"allThreadsContinued": true}
+		resume, resuming = ast.STEP_CONTINUE, true
+	case "next":
+		resume, resuming = ast.STEP_OVER, true
+	case "stepIn":
+		resume, resuming = ast.STEP_IN, true
+	case "stepOut":
+		resume, resuming = ast.STEP_OUT, true
+	case "disconnect":
+		s.stop()
+	default:
+		err = fmt.Errorf("Unsupported request '%s'", msg.Command)
+	}
+
+	if resuming && !s.isStopped() {
+		resuming, body, err = false, nil, fmt.Errorf("The program is not paused")
+	}
+	s.reply(msg, body, err)
+	// the program is only resumed once the client knows it has been, since
+	// it may stop again straight away
+	if resuming {
+		s.resume <- resume
+	}
+
+	if msg.Command == "initialize" {
+		s.event("initialized", nil)
+	}
+	if s.launched && s.configured && s.done == nil {
+		s.start()
+	}
+}
+
+func decodeArguments(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return json.Unmarshal(args, v)
+}
+
+// launch loads the program, which starts running once the client has finished
+// setting breakpoints
+func (s *dapServer) launch(path string, args []string, stopOnEntry bool) error {
+	if s.launched {
+		return fmt.Errorf("A program has already been launched")
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// the program's input would be mixed up with the protocol's, so it has
+	// none
+	interpreter = ast.NewInterpreter(
+		ast.WithArgs(args),
+		ast.WithMaxCallDepth(*maxDepth),
+		ast.WithStdout(dapOutput{s, "stdout"}),
+		ast.WithStdin(strings.NewReader("")),
+		ast.WithDebugger(s.debugger),
+	)
+	interpreter.SetModuleLoader(path, loadModule)
+
+	reporter := newReporter()
+	statements, ok := analyze(string(source), path, reporter)
+	var diagnostics bytes.Buffer
+	reporter.Report(&diagnostics)
+	if diagnostics.Len() > 0 {
+		s.output("stderr", diagnostics.String())
+	}
+	if !ok {
+		return fmt.Errorf("%s has errors", path)
+	}
+
+	s.program = statements
+	s.entry = stopOnEntry
+	if !stopOnEntry {
+		s.debugger.SetMode(ast.STEP_CONTINUE)
+	}
+	s.launched = true
+	return nil
+}
+
+// start runs the program on its own goroutine, reporting how it ended
+func (s *dapServer) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		err := interpreter.Interpret(ctx, s.program)
+
+		exitCode := 0
+		if exit, ok := err.(*ast.ExitException); ok {
+			exitCode = exit.Code()
+		} else if err != nil && err != errDebugQuit {
+			if throw, ok := err.(*ast.ThrowException); ok {
+				err = throw.RuntimeError()
+			}
+			message := err.Error() + "\n"
+			if runtimeErr, ok := err.(*errors.RuntimeError); ok {
+				message = runtimeErr.Traceback() + message
+			}
+			s.output("stderr", message)
+			exitCode = 70
+		}
+
+		s.event("exited", map[string]int{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// stop ends the program, whether it is paused or running, and waits for it
+func (s *dapServer) stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.cancel = nil
+	close(s.resume)
+	<-s.done
+}
+
+// paused is the debugger's pause handler. It tells the client where the
+// program has stopped, then waits for it to be resumed.
+func (s *dapServer) paused(pause *ast.Pause) (ast.StepMode, error) {
+	reason := pause.Reason
+	if s.entry {
+		reason, s.entry = "entry", false
+	}
+
+	s.pauseLock.Lock()
+	s.pause, s.stopped = pause, true
+	s.variables = make([][]ast.DebugVariable, 0)
+	s.pauseLock.Unlock()
+
+	s.event("stopped", map[string]interface{}{
+		"reason":            reason,
+		"threadId":          DAP_THREAD_ID,
+		"allThreadsStopped": true,
+	})
+	mode, ok := <-s.resume
+
+	s.pauseLock.Lock()
+	s.pause, s.stopped = nil, false
+	s.pauseLock.Unlock()
+	if !ok {
+		return ast.STEP_CONTINUE, errDebugQuit
+	}
+	return mode, nil
+}
+
+func (s *dapServer) isStopped() bool {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	return s.stopped
+}
+
+// current returns the pause the program is stopped at. The program's
+// goroutine is blocked until it is resumed, so the pause can be inspected
+// from the main loop.
+func (s *dapServer) current() (*ast.Pause, error) {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	if s.pause == nil {
+		return nil, fmt.Errorf("The program is not paused")
+	}
+	return s.pause, nil
+}
+
+// setBreakpoints replaces the breakpoints in a file. A breakpoint on a line
+// without a statement, like one holding only a closing brace, is moved down to
+// the next line that has one, and left unverified if there isn't one.
+func (s *dapServer) setBreakpoints(path string, breakpoints []dapBreakpoint) interface{} {
+	s.debugger.ClearBreakpoints(path)
+	lines, err := statementLines(path)
+	results := make([]map[string]interface{}, 0, len(breakpoints))
+	for _, breakpoint := range breakpoints {
+		if err != nil {
+			results = append(results, map[string]interface{}{"verified": false, "line": breakpoint.Line, "message": err.Error()})
+			continue
+		}
+		j := sort.SearchInts(lines, breakpoint.Line)
+		if j == len(lines) {
+			results = append(results, map[string]interface{}{"verified": false, "line": breakpoint.Line, "message": "No statement on or after this line"})
+			continue
+		}
+		s.debugger.SetBreakpoint(path, lines[j])
+		results = append(results, map[string]interface{}{"verified": true, "line": lines[j]})
+	}
+	return map[string]interface{}{"breakpoints": results}
+}
+
+// statementLines parses a file to find the lines breakpoints can be hit on
+func statementLines(path string) ([]int, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reporter := errors.NewErrorReporter()
+	scan := scanner.NewScanner(string(source), path, reporter)
+	tokens, scanOk := scan.ScanTokens()
+	statements, parseOk := ast.NewParser(tokens, reporter).Parse()
+	if !scanOk || !parseOk {
+		return nil, fmt.Errorf("%s has syntax errors", path)
+	}
+	return ast.StatementLines(statements), nil
+}
+
+// stackTrace lists the active calls, innermost first. Each frame's id is its
+// index in the list.
+func (s *dapServer) stackTrace() (interface{}, error) {
+	pause, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+
+	stack := pause.Stack()
+	frames := make([]map[string]interface{}, 0, len(stack))
+	for id, frame := range stack {
+		path := frame.Position.File()
+		frames = append(frames, map[string]interface{}{
+			"id":     id,
+			"name":   frame.Name,
+			"source": dapSource{filepath.Base(path), path},
+			"line":   frame.Position.Line,
+			"column": frame.Position.Column,
+		})
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *dapServer) scopes(frame int) (interface{}, error) {
+	pause, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := make([]map[string]interface{}, 0)
+	for _, scope := range pause.Scopes(frame) {
+		name, hint := "Locals", "locals"
+		if scope.Name == "global" {
+			name, hint = "Globals", "globals"
+		}
+		scopes = append(scopes, map[string]interface{}{
+			"name":               name,
+			"presentationHint":   hint,
+			"variablesReference": s.reference(scope.Variables),
+			"expensive":          false,
+		})
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+// reference hands out a variablesReference for a list of variables. References
+// start at 1, since 0 means a variable can't be expanded.
+func (s *dapServer) reference(variables []ast.DebugVariable) int {
+	s.pauseLock.Lock()
+	defer s.pauseLock.Unlock()
+	s.variables = append(s.variables, variables)
+	return len(s.variables)
+}
+
+// expand lists the variables behind a reference. Instances, lists and maps
+// get references of their own, so that the client can expand them in turn.
+func (s *dapServer) expand(reference int) (interface{}, error) {
+	if _, err := s.current(); err != nil {
+		return nil, err
+	}
+	s.pauseLock.Lock()
+	if reference < 1 || reference > len(s.variables) {
+		s.pauseLock.Unlock()
+		return nil, fmt.Errorf("Unknown variables reference %d", reference)
+	}
+	variables := s.variables[reference-1]
+	s.pauseLock.Unlock()
+
+	result := make([]dapVariable, 0, len(variables))
+	for _, variable := range variables {
+		result = append(result, s.variable(variable.Name, variable.Value))
+	}
+	return map[string]interface{}{"variables": result}, nil
+}
+
+func (s *dapServer) variable(name string, value ast.LoxValue) dapVariable {
+	v := dapVariable{Name: name, Value: debugValue(value)}
+	if members := ast.Members(value); len(members) > 0 {
+		v.VariablesReference = s.reference(members)
+	}
+	return v
+}
+
+// evaluate evaluates an expression in a stack frame, with the program's
+// variables in scope
+func (s *dapServer) evaluate(source string, frame int) (interface{}, error) {
+	pause, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+
+	reporter := errors.NewErrorReporter()
+	scan := scanner.NewScanner(source, "<eval>", reporter)
+	tokens, scanOk := scan.ScanTokens()
+	parser := ast.NewParser(tokens, reporter)
+	expr, parseOk := parser.ParseExpression()
+	if !scanOk || !parseOk {
+		return nil, reporter.Err()
+	}
+
+	value, err := pause.Evaluate(frame, expr)
+	if throw, ok := err.(*ast.ThrowException); ok {
+		err = throw.RuntimeError()
+	}
+	if runtimeErr, ok := err.(*errors.RuntimeError); ok {
+		return nil, fmt.Errorf("%s", runtimeErr.Message())
+	} else if err != nil {
+		return nil, err
+	}
+
+	result := s.variable("", value)
+	return map[string]interface{}{"result": result.Value, "variablesReference": result.VariablesReference}, nil
+}
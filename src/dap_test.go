@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/faideww/glox/src/ast"
+)
+
+func TestDapSetBreakpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breakpoints.lox")
+	source := `fun f(x) {
+  if (x > 1) {
+    print x;
+  }
+
+  return fun () {
+    return x;
+  };
+}
+for (var i = 0; i < 2; i = i + 1) {
+  f(i);
+}
+// the end
+`
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &dapServer{debugger: ast.NewDebugger(nil)}
+	body := s.setBreakpoints(path, []dapBreakpoint{{3}, {4}, {5}, {7}, {9}, {12}, {13}})
+	want := map[string]interface{}{"breakpoints": []map[string]interface{}{
+		{"verified": true, "line": 3},
+		{"verified": true, "line": 6},
+		{"verified": true, "line": 6},
+		{"verified": true, "line": 7},
+		{"verified": true, "line": 10},
+		{"verified": false, "line": 12, "message": "No statement on or after this line"},
+		{"verified": false, "line": 13, "message": "No statement on or after this line"},
+	}}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("got %v, want %v", body, want)
+	}
+
+	wantBreakpoints := []ast.Breakpoint{{File: path, Line: 3}, {File: path, Line: 6}, {File: path, Line: 7}, {File: path, Line: 10}}
+	if breakpoints := s.debugger.Breakpoints(); !reflect.DeepEqual(breakpoints, wantBreakpoints) {
+		t.Errorf("breakpoints = %v, want %v", breakpoints, wantBreakpoints)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/faideww/glox/src/ast"
+)
+
+// DEBUG_CONTEXT_LINES is how many lines either side of the current one the
+// list command shows
+const DEBUG_CONTEXT_LINES = 5
+
+const debugHelp = `Commands:
+  s, step             run to the next line, stepping into calls
+  n, next             run to the next line, stepping over calls
+  o, out              run until the current function returns
+  c, continue         run until the next breakpoint
+  b, break [file:]N   set a breakpoint on line N
+  d, delete [file:]N  remove a breakpoint
+  i, info             list breakpoints
+  bt, backtrace       print the call stack
+  v, vars             print the variables in every scope
+  p, print NAME...    print variables
+  l, list             show the source around the current line
+  q, quit             stop the program
+An empty line repeats the previous command.`
+
+// quitting the debugger unwinds the program with this error, which no catch
+// clause will intercept
+var errDebugQuit = fmt.Errorf("quit")
+
+type debugSession struct {
+	input    *bufio.Reader
+	out      io.Writer
+	debugger *ast.Debugger
+	previous []string
+}
+
+// runDebug runs a script under an interactive debugger, which pauses on its
+// first line
+func runDebug(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: glox debug script [args...]")
+	}
+	path := args[0]
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	session := &debugSession{input: bufio.NewReader(os.Stdin), out: os.Stdout}
+	session.debugger = ast.NewDebugger(session.pause)
+	// the program reads from the same buffer as the debugger's prompt, so
+	// that neither swallows the other's input
+	interpreter = ast.NewInterpreter(
+		ast.WithArgs(args[1:]),
+		ast.WithMaxCallDepth(*maxDepth),
+		ast.WithStdin(session.input),
+		ast.WithDebugger(session.debugger),
+	)
+	interpreter.SetModuleLoader(path, loadModule)
+
+	reporter := newReporter()
+	statements, ok := analyze(string(source), path, reporter)
+	report(reporter)
+	if !ok {
+		return fmt.Errorf("%s has errors", path)
+	}
+
+	err = interpreter.Interpret(context.Background(), statements)
+	if exit, ok := err.(*ast.ExitException); ok {
+		fmt.Fprintf(session.out, "Program exited with status %d.\n", exit.Code())
+		return nil
+	}
+	if err == errDebugQuit {
+		return nil
+	}
+	if err != nil {
+		reportError(err)
+		return fmt.Errorf("%s stopped with a runtime error", path)
+	}
+
+	fmt.Fprintln(session.out, "Program finished.")
+	return nil
+}
+
+// pause shows where the program has stopped, then runs commands until one of
+// them resumes it
+func (s *debugSession) pause(pause *ast.Pause) (ast.StepMode, error) {
+	pos := pause.Position()
+	fmt.Fprintf(s.out, "Paused at %s:%d", pos.File(), pos.Line)
+	if pause.Reason == "breakpoint" {
+		fmt.Fprint(s.out, " (breakpoint)")
+	}
+	fmt.Fprintf(s.out, "\n%5d | %s\n", pos.Line, pos.Source.LineText(pos.Line))
+
+	for {
+		fmt.Fprint(s.out, "(debug) ")
+		line, err := s.input.ReadString('\n')
+		if err == io.EOF && line == "" {
+			fmt.Fprintln(s.out)
+			return ast.STEP_CONTINUE, errDebugQuit
+		} else if err != nil && err != io.EOF {
+			return ast.STEP_CONTINUE, err
+		}
+
+		command := strings.Fields(line)
+		if len(command) == 0 {
+			command = s.previous
+		}
+		if len(command) == 0 {
+			continue
+		}
+		s.previous = command
+
+		switch command[0] {
+		case "s", "step":
+			return ast.STEP_IN, nil
+		case "n", "next":
+			return ast.STEP_OVER, nil
+		case "o", "out", "finish":
+			return ast.STEP_OUT, nil
+		case "c", "continue":
+			return ast.STEP_CONTINUE, nil
+		case "b", "break":
+			s.setBreakpoint(pause, command[1:], true)
+		case "d", "delete":
+			s.setBreakpoint(pause, command[1:], false)
+		case "i", "info":
+			s.listBreakpoints()
+		case "bt", "backtrace":
+			s.backtrace(pause)
+		case "v", "vars":
+			s.vars(pause)
+		case "p", "print":
+			s.print(pause, command[1:])
+		case "l", "list":
+			s.list(pause)
+		case "h", "help":
+			fmt.Fprintln(s.out, debugHelp)
+		case "q", "quit":
+			return ast.STEP_CONTINUE, errDebugQuit
+		default:
+			fmt.Fprintf(s.out, "Unknown command '%s'. Type 'help' for a list of commands.\n", command[0])
+		}
+	}
+}
+
+func (s *debugSession) setBreakpoint(pause *ast.Pause, args []string, set bool) {
+	if len(args) != 1 {
+		fmt.Fprintln(s.out, "Expected a line number, or file:line.")
+		return
+	}
+
+	file := pause.Position().File()
+	lineArg := args[0]
+	if sep := strings.LastIndex(lineArg, ":"); sep >= 0 {
+		file, lineArg = lineArg[:sep], lineArg[sep+1:]
+	}
+	line, err := strconv.Atoi(lineArg)
+	if err != nil || line < 1 {
+		fmt.Fprintf(s.out, "Invalid line number '%s'.\n", lineArg)
+		return
+	}
+
+	if set {
+		s.debugger.SetBreakpoint(file, line)
+		fmt.Fprintf(s.out, "Breakpoint set at %s:%d.\n", file, line)
+	} else if s.debugger.ClearBreakpoint(file, line) {
+		fmt.Fprintf(s.out, "Breakpoint removed from %s:%d.\n", file, line)
+	} else {
+		fmt.Fprintf(s.out, "No breakpoint at %s:%d.\n", file, line)
+	}
+}
+
+func (s *debugSession) listBreakpoints() {
+	breakpoints := s.debugger.Breakpoints()
+	if len(breakpoints) == 0 {
+		fmt.Fprintln(s.out, "No breakpoints.")
+	}
+	for _, breakpoint := range breakpoints {
+		fmt.Fprintf(s.out, "  %s:%d\n", breakpoint.File, breakpoint.Line)
+	}
+}
+
+// backtrace prints the call stack, innermost call first
+func (s *debugSession) backtrace(pause *ast.Pause) {
+	for j, frame := range pause.Stack() {
+		fmt.Fprintf(s.out, "  #%d %s at %s:%d\n", j, frame.Name, frame.Position.File(), frame.Position.Line)
+	}
+}
+
+func (s *debugSession) vars(pause *ast.Pause) {
+	for _, scope := range pause.Scopes(0) {
+		if len(scope.Variables) == 0 {
+			continue
+		}
+		fmt.Fprintf(s.out, "%s:\n", scope.Name)
+		for _, variable := range scope.Variables {
+			fmt.Fprintf(s.out, "  %s = %s\n", variable.Name, debugValue(variable.Value))
+		}
+	}
+}
+
+func (s *debugSession) print(pause *ast.Pause, names []string) {
+	if len(names) == 0 {
+		fmt.Fprintln(s.out, "Expected a variable name.")
+	}
+	for _, name := range names {
+		value, ok := pause.Lookup(0, name)
+		if !ok {
+			fmt.Fprintf(s.out, "Undefined variable '%s'.\n", name)
+			continue
+		}
+		fmt.Fprintf(s.out, "%s = %s\n", name, debugValue(value))
+	}
+}
+
+// list shows the source around the current line, marking it with an arrow and
+// breakpoints with an asterisk
+func (s *debugSession) list(pause *ast.Pause) {
+	pos := pause.Position()
+	lineCount := strings.Count(pos.Source.Text, "\n") + 1
+	first := max(1, pos.Line-DEBUG_CONTEXT_LINES)
+	last := min(lineCount, pos.Line+DEBUG_CONTEXT_LINES)
+
+	breakpoints := make(map[int]bool)
+	for _, breakpoint := range s.debugger.Breakpoints() {
+		if breakpoint.File == filepath.Clean(pos.File()) {
+			breakpoints[breakpoint.Line] = true
+		}
+	}
+
+	for line := first; line <= last; line++ {
+		marker := "  "
+		if line == pos.Line {
+			marker = "->"
+		} else if breakpoints[line] {
+			marker = " *"
+		}
+		text := fmt.Sprintf("%s%4d | %s", marker, line, pos.Source.LineText(line))
+		fmt.Fprintln(s.out, strings.TrimRight(text, " "))
+	}
+}
+
+// debugValue shows strings quoted, so that they can be told apart from other
+// values
+func debugValue(value ast.LoxValue) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return ast.ToString(value)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/scanner"
+	"github.com/faideww/glox/src/token"
+)
+
+// jsonToken is the form of a token written by glox tokens --json
+type jsonToken struct {
+	Type    string              `json:"type"`
+	Lexeme  string              `json:"lexeme"`
+	Literal token.LiteralObject `json:"literal"`
+	Line    int                 `json:"line"`
+	Column  int                 `json:"column"`
+	Span    jsonSpan            `json:"span"`
+}
+
+// jsonSpan holds the byte offsets of a token, with end exclusive
+type jsonSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// runTokens lists the tokens the scanner produces for a file, with their
+// positions, types, lexemes and literal values. --json writes one JSON object
+// per token instead.
+func runTokens(args []string) error {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print each token as a JSON object")
+	paths := parseFlags(flags, args)
+	if len(paths) != 1 {
+		return fmt.Errorf("usage: glox tokens file [--json]")
+	}
+
+	source, err := os.ReadFile(paths[0])
+	if err != nil {
+		return err
+	}
+
+	// the tokens are listed even if there were errors, since they may help to
+	// explain them
+	reporter := newReporter()
+	scan := scanner.NewScanner(string(source), paths[0], reporter)
+	tokens, ok := scan.ScanTokens()
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		for _, t := range tokens {
+			err = encoder.Encode(jsonToken{
+				Type:    t.TokenType.String(),
+				Lexeme:  t.Lexeme,
+				Literal: t.Literal,
+				Line:    t.Line,
+				Column:  t.Column,
+				Span:    jsonSpan{t.Start, t.End},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		var table bytes.Buffer
+		writer := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+		for _, t := range tokens {
+			literal := ""
+			if t.Literal != nil {
+				literal = fmt.Sprintf("%#v", t.Literal)
+			}
+			// multi-line strings are kept on one row
+			lexeme := strings.ReplaceAll(t.Lexeme, "\n", "\\n")
+			fmt.Fprintf(writer, "%d:%d\t%s\t%s\t%s\n", t.Line, t.Column, t.TokenType, lexeme, literal)
+		}
+		writer.Flush()
+		for _, row := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+			fmt.Println(strings.TrimRight(row, " "))
+		}
+	}
+
+	if !ok {
+		report(reporter)
+		return fmt.Errorf("%s has syntax errors", paths[0])
+	}
+	return nil
+}
+
+// runAst prints the syntax tree of a file as it comes out of the parser, one
+// S-expression per top-level statement, or as a JSON array with --json
+func runAst(args []string) error {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the tree as JSON")
+	paths := parseFlags(flags, args)
+	if len(paths) != 1 {
+		return fmt.Errorf("usage: glox ast file [--json]")
+	}
+
+	statements, err := parseFile(paths[0])
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(statements)
+	}
+
+	for _, stmt := range statements {
+		fmt.Println(stmt.(ast.Printable).Print())
+	}
+	return nil
+}
+
+// parseFile scans and parses a file without resolving it, reporting any
+// syntax errors
+func parseFile(path string) ([]ast.Stmt, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reporter := newReporter()
+	scan := scanner.NewScanner(string(source), path, reporter)
+	tokens, scanOk := scan.ScanTokens()
+
+	parser := ast.NewParser(tokens, reporter)
+	statements, parseOk := parser.Parse()
+	if !scanOk || !parseOk {
+		report(reporter)
+		return nil, fmt.Errorf("%s has syntax errors", path)
+	}
+	return statements, nil
+}
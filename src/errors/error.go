@@ -2,17 +2,56 @@ package errors
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/faideww/glox/src/token"
 )
 
+type ScannerError struct {
+	position token.Position
+	message  string
+}
+
+func (e *ScannerError) Error() string {
+	message := fmt.Sprintf("[line %d] Error: %s", e.position.Line, e.message)
+	if source := excerpt(e.position); source != "" {
+		message = fmt.Sprintf("%s\n%s", message, strings.TrimSuffix(source, "\n"))
+	}
+	return message
+}
+
+func (e *ScannerError) Message() string {
+	return e.message
+}
+
+func (e *ScannerError) Position() token.Position {
+	return e.position
+}
+
+func NewScannerError(position token.Position, message string) *ScannerError {
+	err := &ScannerError{position, message}
+	return err
+}
+
 type ParserError struct {
 	token   token.Token
 	message string
 }
 
 func (e *ParserError) Error() string {
-	return fmt.Sprintf("[line %d] Error at '%s': %s", e.token.Line, e.token.Lexeme, e.message)
+	message := fmt.Sprintf("[line %d] Error at '%s': %s", e.token.Line, e.token.Lexeme, e.message)
+	if source := excerpt(e.token.Position); source != "" {
+		message = fmt.Sprintf("%s\n%s", message, strings.TrimSuffix(source, "\n"))
+	}
+	return message
+}
+
+func (e *ParserError) Message() string {
+	return e.message
+}
+
+func (e *ParserError) Position() token.Position {
+	return e.token.Position
 }
 
 func NewParserError(token token.Token, message string) *ParserError {
@@ -20,30 +59,174 @@ func NewParserError(token token.Token, message string) *ParserError {
 	return err
 }
 
+// An AnalysisError is a problem found by the resolver or compiler. Despite the
+// name, it may only be a warning (which still allows the program to run), and
+// it may carry notes pointing at related code.
 type AnalysisError struct {
-	token   token.Token
-	message string
+	token    token.Token
+	message  string
+	severity Severity
+	kind     WarningKind
+	notes    []*AnalysisError
 }
 
 func (e *AnalysisError) Error() string {
-	return fmt.Sprintf("%s\n[line %d]\n", e.message, e.token.Line)
+	message := e.message
+	switch e.severity {
+	case SEVERITY_WARNING:
+		message = fmt.Sprintf("Warning: %s", message)
+	case SEVERITY_NOTE:
+		message = fmt.Sprintf("Note: %s", message)
+	}
+	if e.kind != WARN_NONE && e.severity == SEVERITY_ERROR {
+		message = fmt.Sprintf("%s [-Werror=%s]", message, e.kind)
+	} else if e.kind != WARN_NONE {
+		message = fmt.Sprintf("%s [-W%s]", message, e.kind)
+	}
+
+	// errors are reported in the same form as parser errors, since both stop
+	// the program from running
+	var sb strings.Builder
+	if e.severity == SEVERITY_ERROR {
+		fmt.Fprintf(&sb, "[line %d] Error at '%s': %s\n%s", e.token.Line, e.token.Lexeme, message, excerpt(e.token.Position))
+	} else {
+		fmt.Fprintf(&sb, "%s\n[line %d]\n%s", message, e.token.Line, excerpt(e.token.Position))
+	}
+	for _, note := range e.notes {
+		sb.WriteString(note.Error())
+	}
+	return sb.String()
+}
+
+func (e *AnalysisError) Message() string {
+	return e.message
+}
+
+func (e *AnalysisError) Position() token.Position {
+	return e.token.Position
+}
+
+func (e *AnalysisError) Severity() Severity {
+	return e.severity
+}
+
+func (e *AnalysisError) Kind() WarningKind {
+	return e.kind
+}
+
+func (e *AnalysisError) Notes() []*AnalysisError {
+	return e.notes
+}
+
+// AddNote attaches a note about related code, such as the declaration that a
+// variable shadows
+func (e *AnalysisError) AddNote(token token.Token, message string) {
+	e.notes = append(e.notes, &AnalysisError{token, message, SEVERITY_NOTE, WARN_NONE, nil})
 }
 
 func NewAnalysisError(token token.Token, message string) *AnalysisError {
-	err := &AnalysisError{token, message}
+	err := &AnalysisError{token, message, SEVERITY_ERROR, WARN_NONE, nil}
+	return err
+}
+
+func NewAnalysisWarning(token token.Token, kind WarningKind, message string) *AnalysisError {
+	err := &AnalysisError{token, message, SEVERITY_WARNING, kind, nil}
 	return err
 }
 
 type RuntimeError struct {
 	token   token.Token
 	message string
+	trace   []StackFrame
 }
 
 func (e *RuntimeError) Error() string {
-	return fmt.Sprintf("%s\n[line %d]\n", e.message, e.token.Line)
+	return fmt.Sprintf("%s\n[line %d]\n%s", e.message, e.token.Line, excerpt(e.token.Position))
+}
+
+func (e *RuntimeError) Position() token.Position {
+	return e.token.Position
+}
+
+func (e *RuntimeError) Message() string {
+	return e.message
+}
+
+func (e *RuntimeError) Token() token.Token {
+	return e.token
+}
+
+// Trace returns the calls that were active when the error was raised, outermost
+// first, or nil if the interpreter hasn't recorded them
+func (e *RuntimeError) Trace() []StackFrame {
+	return e.trace
+}
+
+func (e *RuntimeError) SetTrace(trace []StackFrame) {
+	e.trace = trace
+}
+
+// Traceback renders the error's stack trace, or an empty string if the error
+// was raised outside of any function call
+func (e *RuntimeError) Traceback() string {
+	if len(e.trace) == 0 {
+		return ""
+	}
+	return FormatTraceback(e.trace, e.token.Line)
 }
 
 func NewRuntimeError(token token.Token, message string) *RuntimeError {
-	err := &RuntimeError{token, message}
+	err := &RuntimeError{token, message, nil}
 	return err
 }
+
+// A StackFrame describes one active call. Line is the line of the call site,
+// in the frame that made the call.
+type StackFrame struct {
+	Function string `json:"function"`
+	Class    string `json:"class,omitempty"`
+	Line     int    `json:"line"`
+}
+
+func (f StackFrame) String() string {
+	if f.Class != "" {
+		return fmt.Sprintf("%s.%s", f.Class, f.Function)
+	}
+	return f.Function
+}
+
+// FormatTraceback renders a stack trace in the style of Python's, with the most
+// recent call last. errLine is the line the innermost frame was executing.
+// Runs of identical entries, as in deep recursion, are collapsed after the
+// first few.
+func FormatTraceback(frames []StackFrame, errLine int) string {
+	entries := make([]string, 0, len(frames)+1)
+	name := "<script>"
+	for _, frame := range frames {
+		entries = append(entries, fmt.Sprintf("  [line %d] in %s\n", frame.Line, name))
+		name = frame.String()
+	}
+	entries = append(entries, fmt.Sprintf("  [line %d] in %s\n", errLine, name))
+
+	var sb strings.Builder
+	sb.WriteString("Traceback (most recent call last):\n")
+	repeats := 0
+	for j, entry := range entries {
+		if j > 0 && entry == entries[j-1] {
+			repeats++
+		} else {
+			repeats = 0
+		}
+
+		if repeats < tracebackRepeatLimit {
+			sb.WriteString(entry)
+		}
+		last := j == len(entries)-1 || entries[j+1] != entry
+		if last && repeats >= tracebackRepeatLimit {
+			fmt.Fprintf(&sb, "  [Previous line repeated %d more times]\n", repeats-tracebackRepeatLimit+1)
+		}
+	}
+	return sb.String()
+}
+
+const tracebackRepeatLimit = 3
@@ -0,0 +1,64 @@
+package errors
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/faideww/glox/src/token"
+)
+
+// excerpt renders the line of source that pos is on with the token there
+// underlined, in the style of rustc and clang:
+//
+//	 --> script.lox:3:7
+//	  |
+//	3 | print foo bar;
+//	  |       ^^^
+//
+// Positions that aren't in a source (such as tokens made up by the bytecode
+// VM) have no excerpt.
+func excerpt(pos token.Position) string {
+	if pos.Source == nil || pos.Line < 1 {
+		return ""
+	}
+
+	text := pos.Source.LineText(pos.Line)
+	gutter := strings.Repeat(" ", len(fmt.Sprint(pos.Line)))
+
+	// tokens that run past the end of the line (multi-line strings) are only
+	// underlined up to the end of it
+	lineRunes := utf8.RuneCountInString(text)
+	width := utf8.RuneCountInString(pos.Source.Text[pos.Start:pos.End])
+	if pos.Column+width-1 > lineRunes {
+		width = lineRunes - pos.Column + 1
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	// keep tabs in the indentation so that the carets line up with the text
+	var indent strings.Builder
+	column := 1
+	for _, r := range text {
+		if column >= pos.Column {
+			break
+		}
+		if r == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+		column++
+	}
+	for ; column < pos.Column; column++ {
+		indent.WriteRune(' ')
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s--> %s:%d:%d\n", gutter, pos.File(), pos.Line, pos.Column)
+	fmt.Fprintf(&sb, "%s |\n", gutter)
+	fmt.Fprintf(&sb, "%d | %s\n", pos.Line, text)
+	fmt.Fprintf(&sb, "%s | %s%s\n", gutter, indent.String(), strings.Repeat("^", width))
+	return sb.String()
+}
@@ -0,0 +1,92 @@
+package errors
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/faideww/glox/src/token"
+)
+
+// jsonDiagnostic is the machine-readable form of a collected error, as written
+// by ReportJSON
+type jsonDiagnostic struct {
+	Phase    string           `json:"phase"`
+	Severity string           `json:"severity"`
+	Kind     string           `json:"kind,omitempty"`
+	Message  string           `json:"message"`
+	File     string           `json:"file"`
+	Line     int              `json:"line"`
+	Column   int              `json:"column"`
+	Span     jsonSpan         `json:"span"`
+	Notes    []jsonDiagnostic `json:"notes,omitempty"`
+	Trace    []StackFrame     `json:"trace,omitempty"`
+}
+
+// jsonSpan holds the byte offsets of the offending token, with end exclusive
+type jsonSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Phase names the stage of the interpreter that produces a kind of error
+func Phase(err error) string {
+	switch err.(type) {
+	case *ScannerError:
+		return "scan"
+	case *ParserError:
+		return "parse"
+	case *AnalysisError:
+		return "analysis"
+	case *RuntimeError:
+		return "runtime"
+	}
+	return "unknown"
+}
+
+func newJSONDiagnostic(err error) jsonDiagnostic {
+	d := jsonDiagnostic{
+		Phase:    Phase(err),
+		Severity: SeverityOf(err).String(),
+		Message:  err.Error(),
+	}
+
+	if messenger, ok := err.(interface{ Message() string }); ok {
+		d.Message = messenger.Message()
+	}
+
+	if diagnostic, ok := err.(Diagnostic); ok {
+		d.setPosition(diagnostic.Position())
+	}
+
+	switch err := err.(type) {
+	case *AnalysisError:
+		if err.kind != WARN_NONE {
+			d.Kind = err.kind.String()
+		}
+		for _, note := range err.notes {
+			d.Notes = append(d.Notes, newJSONDiagnostic(note))
+		}
+	case *RuntimeError:
+		d.Trace = err.trace
+	}
+
+	return d
+}
+
+func (d *jsonDiagnostic) setPosition(pos token.Position) {
+	d.File = pos.File()
+	d.Line = pos.Line
+	d.Column = pos.Column
+	d.Span = jsonSpan{pos.Start, pos.End}
+}
+
+// ReportJSON writes every collected error as a JSON object on its own line,
+// ordered by position as in Report
+func (r *ErrorReporter) ReportJSON(w io.Writer) {
+	encoder := json.NewEncoder(w)
+	for _, err := range r.Errors() {
+		// the diagnostic is made entirely of encodable values, so this can't
+		// fail other than by w failing, which we can't do anything about
+		_ = encoder.Encode(newJSONDiagnostic(err))
+	}
+}
@@ -1,34 +1,110 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"io"
+	"sort"
+
+	"github.com/faideww/glox/src/token"
 )
 
+// A Diagnostic is an error that can be located in the source
+type Diagnostic interface {
+	error
+	Position() token.Position
+}
+
 type ErrorReporter struct {
-	errors []error
+	errors           []error
+	warningsAsErrors bool
+	suppressed       map[WarningKind]bool
 }
 
 func NewErrorReporter() *ErrorReporter {
 	return &ErrorReporter{
-		errors: make([]error, 0),
+		errors:     make([]error, 0),
+		suppressed: make(map[WarningKind]bool),
 	}
 }
 
+// SetWarningsAsErrors makes every warning collected afterwards an error
+func (r *ErrorReporter) SetWarningsAsErrors(enabled bool) {
+	r.warningsAsErrors = enabled
+}
+
+// Suppress drops every warning of the given kind collected afterwards
+func (r *ErrorReporter) Suppress(kind WarningKind) {
+	r.suppressed[kind] = true
+}
+
 func (r *ErrorReporter) Collect(err error) {
+	if warning, ok := err.(*AnalysisError); ok && warning.severity == SEVERITY_WARNING {
+		if r.suppressed[warning.kind] {
+			return
+		}
+		if r.warningsAsErrors {
+			warning.severity = SEVERITY_ERROR
+		}
+	}
 	r.errors = append(r.errors, err)
 }
 
 func (r *ErrorReporter) Clear() {
-	clear(r.errors[:])
+	r.errors = r.errors[:0]
 }
 
-func (r *ErrorReporter) Report(w io.Writer) {
+// HasErrors reports whether any errors have been collected, ignoring warnings
+func (r *ErrorReporter) HasErrors() bool {
 	for _, err := range r.errors {
+		if SeverityOf(err) == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns every collected error, ordered by where they occur in the
+// source rather than by the phase that found them. Errors without a position
+// come last.
+func (r *ErrorReporter) Errors() []error {
+	sorted := make([]error, len(r.errors))
+	copy(sorted, r.errors)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return positionLess(sorted[a], sorted[b])
+	})
+	return sorted
+}
+
+func positionLess(a error, b error) bool {
+	da, aOk := a.(Diagnostic)
+	db, bOk := b.(Diagnostic)
+	if !aOk || !bOk {
+		return aOk && !bOk
+	}
+
+	pa, pb := da.Position(), db.Position()
+	if pa.File() != pb.File() {
+		return pa.File() < pb.File()
+	}
+	if pa.Line != pb.Line {
+		return pa.Line < pb.Line
+	}
+	return pa.Column < pb.Column
+}
+
+func (r *ErrorReporter) Report(w io.Writer) {
+	for _, err := range r.Errors() {
 		fmt.Fprintln(w, err)
 	}
 }
 
+// Err combines every collected error (including warnings) into one, or returns
+// nil if there are none
+func (r *ErrorReporter) Err() error {
+	return stderrors.Join(r.Errors()...)
+}
+
 func (r *ErrorReporter) Last() error {
 	if len(r.errors) < 1 {
 		return nil
@@ -0,0 +1,63 @@
+package errors
+
+import "sort"
+
+type Severity int
+
+const (
+	SEVERITY_ERROR = iota
+	SEVERITY_WARNING
+	SEVERITY_NOTE
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SEVERITY_WARNING:
+		return "warning"
+	case SEVERITY_NOTE:
+		return "note"
+	}
+	return "error"
+}
+
+// SeverityOf returns the severity of a collected error. Anything other than an
+// analysis warning or note is an error.
+func SeverityOf(err error) Severity {
+	if analysisErr, ok := err.(*AnalysisError); ok {
+		return analysisErr.severity
+	}
+	return SEVERITY_ERROR
+}
+
+// A WarningKind identifies a class of warning, so that it can be suppressed
+// or promoted to an error from the command line
+type WarningKind int
+
+const (
+	WARN_NONE = iota
+	WARN_UNUSED
+	WARN_SHADOW
+	WARN_UNREACHABLE
+)
+
+var warningNames = map[WarningKind]string{
+	WARN_UNUSED:      "unused",
+	WARN_SHADOW:      "shadow",
+	WARN_UNREACHABLE: "unreachable",
+}
+
+func (k WarningKind) String() string {
+	return warningNames[k]
+}
+
+// WarningKinds lists every kind of warning, ordered by name
+func WarningKinds() []WarningKind {
+	kinds := make([]WarningKind, 0, len(warningNames))
+	for kind := range warningNames {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(a, b int) bool {
+		return kinds[a].String() < kinds[b].String()
+	})
+	return kinds
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/scanner"
+)
+
+// runFmt formats Lox source files. By default the formatted source is printed
+// to stdout. With --check, the files that aren't already formatted are listed
+// and the command fails if there are any; with --write, they are rewritten in
+// place.
+func runFmt(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list files whose formatting differs, and fail if there are any")
+	write := flags.Bool("write", false, "rewrite files in place")
+	paths := parseFlags(flags, args)
+
+	if *check && *write {
+		return fmt.Errorf("--check and --write can't be used together")
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("usage: glox fmt [--check | --write] file...")
+	}
+
+	unformatted := 0
+	for _, path := range paths {
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		source := string(bytes)
+
+		formatted, err := formatSource(source, path)
+		if err != nil {
+			return err
+		}
+
+		if *check {
+			if formatted != source {
+				fmt.Println(path)
+				unformatted++
+			}
+		} else if *write {
+			if formatted != source {
+				info, err := os.Stat(path)
+				if err != nil {
+					return err
+				}
+				err = os.WriteFile(path, []byte(formatted), info.Mode())
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			fmt.Print(formatted)
+		}
+	}
+
+	if unformatted > 0 {
+		return fmt.Errorf("%d file(s) need formatting", unformatted)
+	}
+	return nil
+}
+
+// formatSource formats a program, which must scan and parse without errors.
+// The result is formatted a second time to make sure that it parses and that
+// formatting it again wouldn't change it.
+func formatSource(source string, filename string) (string, error) {
+	formatted, err := format(source, filename)
+	if err != nil {
+		return "", err
+	}
+
+	again, err := format(formatted, filename)
+	if err != nil || again != formatted {
+		return "", fmt.Errorf("internal error: the formatted source of %s is not stable", filename)
+	}
+	return formatted, nil
+}
+
+func format(source string, filename string) (string, error) {
+	reporter := newReporter()
+	scan := scanner.NewScanner(source, filename, reporter)
+	tokens, scanOk := scan.ScanTokens()
+
+	parser := ast.NewParser(tokens, reporter)
+	statements, parseOk := parser.Parse()
+	if !scanOk || !parseOk {
+		report(reporter)
+		return "", fmt.Errorf("%s has syntax errors", filename)
+	}
+
+	return ast.NewFormatter(tokens, scan.Comments()).Format(statements), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/scanner"
+)
+
+// printTree parses a program and prints its syntax tree, or returns false if
+// it has syntax errors
+func printTree(source string, filename string) (string, bool) {
+	reporter := errors.NewErrorReporter()
+	scan := scanner.NewScanner(source, filename, reporter)
+	tokens, scanOk := scan.ScanTokens()
+	statements, parseOk := ast.NewParser(tokens, reporter).Parse()
+	if !scanOk || !parseOk {
+		return "", false
+	}
+
+	var tree strings.Builder
+	for _, stmt := range statements {
+		tree.WriteString(stmt.(ast.Printable).Print())
+		tree.WriteString("\n")
+	}
+	return tree.String(), true
+}
+
+func TestFormatExamples(t *testing.T) {
+	err := filepath.WalkDir("../lox", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".lox" {
+			return err
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// examples of syntax errors can't be formatted
+		tree, ok := printTree(string(source), path)
+		if !ok {
+			return nil
+		}
+
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			formatted, err := format(string(source), path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := format(formatted, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != formatted {
+				t.Errorf("formatting twice changed it from:\n%s\nto:\n%s", formatted, again)
+			}
+
+			formattedTree, ok := printTree(formatted, path)
+			if !ok {
+				t.Fatalf("the formatted source doesn't parse:\n%s", formatted)
+			}
+			if formattedTree != tree {
+				t.Errorf("formatting changed the syntax tree from:\n%s\nto:\n%s", tree, formattedTree)
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
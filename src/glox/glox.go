@@ -0,0 +1,213 @@
+// Package glox embeds the Lox tree-walking interpreter in Go programs.
+//
+//	lox := glox.New(glox.WithStdout(&out))
+//	err := lox.Run(`var greeting = "hello";`, "greeting.lox")
+//	value, err := lox.Eval(`greeting + " world"`)
+//
+// Globals defined by one call to Run or Eval are visible to the next, so an
+// Interpreter behaves like a REPL session driven from Go.
+package glox
+
+import (
+	"context"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/scanner"
+)
+
+// A Value is any Lox value: nil, bool, float64, string, or one of the ast
+// package's runtime types like *ast.LoxInstance
+type Value = ast.LoxValue
+
+// Limits bounds the steps, time, instances, string memory and collection
+// elements a single call to Run or Eval may use. Exceeding one stops the program with a *LimitError.
+type Limits = ast.Limits
+
+type LimitError = ast.LimitError
+
+type Interpreter struct {
+	interpreter *ast.Interpreter
+	options     []ast.InterpreterOption
+	diagnostics io.Writer
+}
+
+type Option func(l *Interpreter)
+
+// WithStdout sends the output of print statements to w instead of os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(l *Interpreter) {
+		l.options = append(l.options, ast.WithStdout(w))
+	}
+}
+
+// WithStdin reads the input for io.readLine() from r instead of os.Stdin
+func WithStdin(r io.Reader) Option {
+	return func(l *Interpreter) {
+		l.options = append(l.options, ast.WithStdin(r))
+	}
+}
+
+// WithDiagnostics writes warnings about programs that still run to w. By
+// default they are discarded.
+func WithDiagnostics(w io.Writer) Option {
+	return func(l *Interpreter) {
+		l.diagnostics = w
+	}
+}
+
+// WithArgs sets the arguments returned by os.args()
+func WithArgs(args ...string) Option {
+	return func(l *Interpreter) {
+		l.options = append(l.options, ast.WithArgs(args))
+	}
+}
+
+// WithMaxCallDepth limits how deeply calls may nest before a "Stack overflow"
+// runtime error
+func WithMaxCallDepth(depth int) Option {
+	return func(l *Interpreter) {
+		l.options = append(l.options, ast.WithMaxCallDepth(depth))
+	}
+}
+
+// WithNamespaces limits the standard library to the given namespaces, such as
+// "math" or "str". By default every namespace is enabled.
+func WithNamespaces(names ...string) Option {
+	return func(l *Interpreter) {
+		l.options = append(l.options, ast.WithNamespaces(names...))
+	}
+}
+
+// WithLimits sets the limits each call to Run or Eval runs under. The program
+// can't catch a LimitError, and the interpreter can be used again afterwards.
+func WithLimits(limits Limits) Option {
+	return func(l *Interpreter) {
+		l.options = append(l.options, ast.WithLimits(limits))
+	}
+}
+
+func New(options ...Option) *Interpreter {
+	l := &Interpreter{
+		options:     make([]ast.InterpreterOption, 0),
+		diagnostics: io.Discard,
+	}
+	for _, option := range options {
+		option(l)
+	}
+	l.interpreter = ast.NewInterpreter(l.options...)
+	l.interpreter.SetModuleLoader("", l.loadModule)
+	return l
+}
+
+// Run executes a program. filename is used in error messages and to find the
+// files it imports. Syntax and analysis errors are returned together, joined
+// into one error, without running anything. Otherwise the error is whatever
+// stopped the program: an *errors.RuntimeError, an *ast.ThrowException for an
+// uncaught exception, an *ast.ExitException if it called os.exit(), or a
+// *LimitError.
+func (l *Interpreter) Run(source string, filename string) error {
+	return l.RunContext(context.Background(), source, filename)
+}
+
+// RunContext is Run, stopping the program with an "Interrupted" runtime error
+// if ctx is cancelled. Like a LimitError, the program can't catch it.
+func (l *Interpreter) RunContext(ctx context.Context, source string, filename string) error {
+	l.interpreter.SetModuleLoader(filename, l.loadModule)
+
+	statements, err := l.analyze(source, filename)
+	if err != nil {
+		return err
+	}
+	return l.interpreter.Interpret(ctx, statements)
+}
+
+// Eval evaluates a single expression and returns its value
+func (l *Interpreter) Eval(expr string) (Value, error) {
+	return l.EvalContext(context.Background(), expr)
+}
+
+// EvalContext is Eval, stopping with an "Interrupted" runtime error if ctx is
+// cancelled
+func (l *Interpreter) EvalContext(ctx context.Context, expr string) (Value, error) {
+	reporter := errors.NewErrorReporter()
+	scan := scanner.NewScanner(expr, "<eval>", reporter)
+	tokens, scanOk := scan.ScanTokens()
+
+	parser := ast.NewParser(tokens, reporter)
+	expression, parseOk := parser.ParseExpression()
+	if !scanOk || !parseOk {
+		return nil, reporter.Err()
+	}
+
+	resolver := ast.NewResolver(l.interpreter, reporter)
+	if !resolver.ResolveExpression(expression) {
+		return nil, reporter.Err()
+	}
+	reporter.Report(l.diagnostics)
+
+	return l.interpreter.InterpretExpression(ctx, expression)
+}
+
+// GetGlobal returns the value of a global variable, or of a native function
+func (l *Interpreter) GetGlobal(name string) (Value, bool) {
+	return l.interpreter.Global(name)
+}
+
+// SetGlobal defines a global variable, replacing any existing value
+func (l *Interpreter) SetGlobal(name string, value Value) {
+	l.interpreter.DefineGlobal(name, value)
+}
+
+// Bind exposes a Go value to Lox programs as a global. Functions become native
+// functions that convert their arguments and results, with returned errors
+// raised as runtime errors, and structs become instances whose exported fields
+// and methods can be used from Lox. See ast.ToLox for how other values are
+// converted.
+func (l *Interpreter) Bind(name string, value interface{}) error {
+	var converted Value
+	var err error
+	if reflect.ValueOf(value).Kind() == reflect.Func {
+		converted, err = ast.NewHostFunction(name, value)
+	} else {
+		converted, err = ast.ToLox(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	l.interpreter.DefineGlobal(name, converted)
+	return nil
+}
+
+// analyze scans, parses and resolves a program, returning every error found
+func (l *Interpreter) analyze(source string, filename string) ([]ast.Stmt, error) {
+	reporter := errors.NewErrorReporter()
+	scan := scanner.NewScanner(source, filename, reporter)
+	tokens, scanOk := scan.ScanTokens()
+
+	parser := ast.NewParser(tokens, reporter)
+	statements, parseOk := parser.Parse()
+	if !scanOk || !parseOk {
+		return nil, reporter.Err()
+	}
+
+	resolver := ast.NewResolver(l.interpreter, reporter)
+	if !resolver.Resolve(statements) {
+		return nil, reporter.Err()
+	}
+	reporter.Report(l.diagnostics)
+
+	return statements, nil
+}
+
+func (l *Interpreter) loadModule(path string) ([]ast.Stmt, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return l.analyze(string(source), path)
+}
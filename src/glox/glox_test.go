@@ -0,0 +1,225 @@
+package glox_test
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/glox"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	l := glox.New(glox.WithStdout(&out))
+	err := l.Run(`
+var greeting = "hello";
+print greeting + " world";
+`, "run.lox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello world\n" {
+		t.Errorf("output = %q", out.String())
+	}
+
+	// globals carry over to the next call
+	err = l.Run("print greeting;", "run.lox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello world\nhello\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestEval(t *testing.T) {
+	l := glox.New()
+	if err := l.Run("fun square(x) { return x * x; }", "eval.lox"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		expr string
+		want glox.Value
+	}{
+		{"1 + 2", 3.0},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"nil", nil},
+		{"square(4)", 16.0},
+	}
+	for _, c := range cases {
+		value, err := l.Eval(c.expr)
+		if err != nil {
+			t.Errorf("Eval(%s): %s", c.expr, err)
+			continue
+		}
+		if value != c.want {
+			t.Errorf("Eval(%s) = %#v, want %#v", c.expr, value, c.want)
+		}
+	}
+
+	value, err := l.Eval("[1, 2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := value.(*ast.LoxList); !ok || ast.ToString(value) != "[1, 2]" {
+		t.Errorf("Eval([1, 2]) = %#v", value)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	l := glox.New()
+	l.SetGlobal("count", 1.0)
+	if err := l.Run("count = count + 1; var name = \"lox\";", "globals.lox"); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, ok := l.GetGlobal("count"); !ok || count != 2.0 {
+		t.Errorf("count = %v, %v", count, ok)
+	}
+	if name, ok := l.GetGlobal("name"); !ok || name != "lox" {
+		t.Errorf("name = %v, %v", name, ok)
+	}
+	if _, ok := l.GetGlobal("missing"); ok {
+		t.Error("GetGlobal(missing) should fail")
+	}
+	if _, ok := l.GetGlobal("clock"); !ok {
+		t.Error("GetGlobal should find native functions")
+	}
+}
+
+func TestBind(t *testing.T) {
+	var out bytes.Buffer
+	l := glox.New(glox.WithStdout(&out))
+	err := l.Bind("repeat", func(s string, n int) string { return strings.Repeat(s, n) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Run(`print repeat("ab", 3);`, "bind.lox"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ababab\n" {
+		t.Errorf("output = %q", out.String())
+	}
+
+	value, err := l.Eval(`repeat("x", 2)`)
+	if err != nil || value != "xx" {
+		t.Errorf("Eval = %v, %v", value, err)
+	}
+
+	if err := l.Bind("ch", make(chan int)); err == nil {
+		t.Error("binding a channel should fail")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	var out bytes.Buffer
+	l := glox.New(glox.WithStdout(&out))
+	err := l.Run(`print "not run"; var 1; print (;`, "errors.lox")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var parserErr *errors.ParserError
+	if !stderrors.As(err, &parserErr) {
+		t.Errorf("got %v, want a *errors.ParserError", err)
+	}
+	// every error is reported, not just the first
+	for _, message := range []string{"Expect variable name", "expected expression"} {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("error %q doesn't mention %q", err, message)
+		}
+	}
+	if out.Len() > 0 {
+		t.Errorf("the program ran and printed %q", out.String())
+	}
+
+	err = l.Run("{ var a = 1; print a; var a = 2; print a; }", "errors.lox")
+	var analysisErr *errors.AnalysisError
+	if !stderrors.As(err, &analysisErr) || analysisErr.Severity() != errors.SEVERITY_ERROR {
+		t.Errorf("got %v, want an *errors.AnalysisError", err)
+	}
+
+	if _, err := l.Eval("1 +"); err == nil {
+		t.Error("Eval of an incomplete expression should fail")
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	l := glox.New()
+	err := l.Run("var a = 1;\nprint -\"a\";", "errors.lox")
+	runtimeErr, ok := err.(*errors.RuntimeError)
+	if !ok {
+		t.Fatalf("got %v (%T), want a *errors.RuntimeError", err, err)
+	}
+	if runtimeErr.Message() != "Operand must be a number" || runtimeErr.Position().Line != 2 {
+		t.Errorf("got %q on line %d", runtimeErr.Message(), runtimeErr.Position().Line)
+	}
+
+	_, err = l.Eval("nil.x")
+	if _, ok := err.(*errors.RuntimeError); !ok {
+		t.Errorf("Eval: got %v (%T), want a *errors.RuntimeError", err, err)
+	}
+
+	err = l.Run(`throw "oops";`, "errors.lox")
+	if _, ok := err.(*ast.ThrowException); !ok {
+		t.Errorf("got %v (%T), want an *ast.ThrowException", err, err)
+	}
+
+	err = l.Run("os.exit(3);", "errors.lox")
+	if exit, ok := err.(*ast.ExitException); !ok || exit.Code() != 3 {
+		t.Errorf("got %v (%T), want an *ast.ExitException with code 3", err, err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	var out bytes.Buffer
+	l := glox.New(glox.WithStdout(&out))
+	programs := []string{
+		"while (true) {}",
+		"fun spin() { while (true) {} } spin();",
+		// the program can't catch the interruption, even with a catch clause
+		// that does nothing
+		`try { while (true) {} } catch (e) { print "caught"; }`,
+		"try { while (true) {} } catch (e) {}",
+		`try { while (true) {} } finally { print "finally"; }`,
+	}
+	for _, program := range programs {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		start := time.Now()
+		err := l.RunContext(ctx, program, "cancel.lox")
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: took %s to stop", program, elapsed)
+		}
+		runtimeErr, ok := err.(*errors.RuntimeError)
+		if !ok || runtimeErr.Message() != "Interrupted" {
+			t.Errorf("%s: got %v, want an Interrupted runtime error", program, err)
+		}
+	}
+	if out.Len() > 0 {
+		t.Errorf("the program printed %q", out.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := l.Run("fun spin() { while (true) {} }", "cancel.lox"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := l.EvalContext(ctx, "spin()")
+	if runtimeErr, ok := err.(*errors.RuntimeError); !ok || runtimeErr.Message() != "Interrupted" {
+		t.Errorf("EvalContext: got %v, want an Interrupted runtime error", err)
+	}
+
+	// the interpreter can be used again with a fresh context
+	value, err := l.Eval("1 + 1")
+	if err != nil || value != 2.0 {
+		t.Errorf("Eval after cancelling = %v, %v", value, err)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Golden tests are Lox scripts whose expected behaviour is written in comments,
+// following the conventions of the Crafting Interpreters test suite:
+//
+//	print 1 + 2;  // expect: 3
+//	print nil.x;  // expect runtime error: Only instances have properties
+//	var 1;        // Error at '1': Expect variable name
+//	              // [line 3] Error at '1': Expect variable name
+//
+// Compile errors are expected on the line of their comment unless it gives
+// one. Errors marked with "[java line N]" only apply to the tree-walking
+// interpreter and those marked "[c line N]" only to the bytecode VM. Files
+// containing "// nontest" are skipped, and those containing "// java only" or
+// "// c only" are skipped on the other interpreter.
+var (
+	expectedOutputPattern       = regexp.MustCompile(`// expect: ?(.*)`)
+	expectedErrorPattern        = regexp.MustCompile(`// (Error.*)`)
+	errorLinePattern            = regexp.MustCompile(`// \[((java|c) )?line (\d+)\] (Error.*)`)
+	expectedRuntimeErrorPattern = regexp.MustCompile(`// expect runtime error: (.+)`)
+	syntaxErrorPattern          = regexp.MustCompile(`^\[.*line (\d+)\] (Error.+)`)
+	stackTracePattern           = regexp.MustCompile(`^\[line (\d+)\]`)
+	nonTestPattern              = regexp.MustCompile(`// nontest`)
+	variantOnlyPattern          = regexp.MustCompile(`// (java|c) only`)
+)
+
+// GOLDEN_TIMEOUT is how long a single test may run before it fails
+const GOLDEN_TIMEOUT = 10 * time.Second
+
+type goldenTest struct {
+	path             string
+	output           []goldenLine
+	compileErrors    []string
+	runtimeError     string
+	runtimeErrorLine int
+	exitCode         int
+}
+
+type goldenLine struct {
+	text string
+	line int
+}
+
+// parseGoldenTest reads the expectations from a test script. It returns nil
+// for scripts that aren't tests.
+func parseGoldenTest(path string, vm bool) (*goldenTest, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	test := &goldenTest{path: path, compileErrors: make([]string, 0)}
+	variant := "java"
+	if vm {
+		variant = "c"
+	}
+
+	for i, text := range strings.Split(string(source), "\n") {
+		line := i + 1
+		if nonTestPattern.MatchString(text) {
+			return nil, nil
+		}
+		if match := variantOnlyPattern.FindStringSubmatch(text); match != nil && match[1] != variant {
+			return nil, nil
+		}
+
+		if match := expectedOutputPattern.FindStringSubmatch(text); match != nil {
+			test.output = append(test.output, goldenLine{match[1], line})
+		} else if match := expectedErrorPattern.FindStringSubmatch(text); match != nil {
+			test.compileErrors = append(test.compileErrors, fmt.Sprintf("[line %d] %s", line, match[1]))
+			test.exitCode = 65
+		} else if match := errorLinePattern.FindStringSubmatch(text); match != nil {
+			if match[2] == "" || match[2] == variant {
+				test.compileErrors = append(test.compileErrors, fmt.Sprintf("[line %s] %s", match[3], match[4]))
+				test.exitCode = 65
+			}
+		} else if match := expectedRuntimeErrorPattern.FindStringSubmatch(text); match != nil {
+			test.runtimeError = match[1]
+			test.runtimeErrorLine = line
+			test.exitCode = 70
+		}
+	}
+
+	if len(test.compileErrors) > 0 && test.runtimeError != "" {
+		return nil, fmt.Errorf("%s: can't expect both compile and runtime errors", path)
+	}
+	return test, nil
+}
+
+// run executes the test with the given interpreter and returns a description
+// of each way in which it failed
+func (test *goldenTest) run(interpreter string, args []string, env []string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), GOLDEN_TIMEOUT)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, interpreter, append(args, test.path)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), env...)
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return []string{fmt.Sprintf("Timed out after %s.", GOLDEN_TIMEOUT)}
+	}
+	exitCode := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return []string{err.Error()}
+	}
+
+	failures := make([]string, 0)
+	errorLines := splitLines(stderr.String())
+	if test.runtimeError != "" {
+		failures = append(failures, test.checkRuntimeError(errorLines)...)
+	} else {
+		failures = append(failures, test.checkCompileErrors(errorLines)...)
+	}
+
+	if exitCode != test.exitCode {
+		failures = append(failures, fmt.Sprintf("Expected return code %d and got %d.", test.exitCode, exitCode))
+	}
+
+	return append(failures, test.checkOutput(splitLines(stdout.String()))...)
+}
+
+// checkRuntimeError looks for the error message followed by the line it was
+// raised on, after any traceback
+func (test *goldenTest) checkRuntimeError(errorLines []string) []string {
+	for i, text := range errorLines {
+		if text != test.runtimeError {
+			continue
+		}
+		if i+1 >= len(errorLines) {
+			return []string{fmt.Sprintf("Expected a line number after runtime error '%s'.", test.runtimeError)}
+		}
+		match := stackTracePattern.FindStringSubmatch(errorLines[i+1])
+		if match == nil {
+			return []string{fmt.Sprintf("Expected a line number after runtime error '%s' and got '%s'.", test.runtimeError, errorLines[i+1])}
+		}
+		if line, _ := strconv.Atoi(match[1]); line != test.runtimeErrorLine {
+			return []string{fmt.Sprintf("Expected runtime error on line %d but was on line %d.", test.runtimeErrorLine, line)}
+		}
+		return nil
+	}
+
+	if len(errorLines) == 0 {
+		return []string{fmt.Sprintf("Expected runtime error '%s' and got none.", test.runtimeError)}
+	}
+	return []string{fmt.Sprintf("Expected runtime error '%s' and got:\n%s", test.runtimeError, strings.Join(errorLines, "\n"))}
+}
+
+// checkCompileErrors compares the compile errors reported with the expected
+// ones. Other lines on stderr, like source excerpts and warnings, are ignored.
+func (test *goldenTest) checkCompileErrors(errorLines []string) []string {
+	found := make([]string, 0)
+	for _, text := range errorLines {
+		if syntaxErrorPattern.MatchString(text) {
+			found = append(found, text)
+		}
+	}
+
+	failures := make([]string, 0)
+	for _, missing := range difference(test.compileErrors, found) {
+		failures = append(failures, fmt.Sprintf("Missing expected error: %s", missing))
+	}
+	for _, unexpected := range difference(found, test.compileErrors) {
+		failures = append(failures, fmt.Sprintf("Unexpected error: %s", unexpected))
+	}
+	return failures
+}
+
+func (test *goldenTest) checkOutput(outputLines []string) []string {
+	failures := make([]string, 0)
+	for i, text := range outputLines {
+		if i >= len(test.output) {
+			failures = append(failures, fmt.Sprintf("Got output '%s' when none was expected.", text))
+			continue
+		}
+		expected := test.output[i]
+		if text != expected.text {
+			failures = append(failures, fmt.Sprintf("Expected output '%s' on line %d and got '%s'.", expected.text, expected.line, text))
+		}
+	}
+	for _, expected := range test.output[min(len(outputLines), len(test.output)):] {
+		failures = append(failures, fmt.Sprintf("Missing expected output '%s' on line %d.", expected.text, expected.line))
+	}
+	return failures
+}
+
+// findGoldenTests finds every test script under dir, in a stable order
+func findGoldenTests(dir string, vm bool) ([]*goldenTest, error) {
+	tests := make([]*goldenTest, 0)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".lox" {
+			return nil
+		}
+
+		test, err := parseGoldenTest(path, vm)
+		if err != nil {
+			return err
+		}
+		if test != nil {
+			tests = append(tests, test)
+		}
+		return nil
+	})
+	sort.Slice(tests, func(a, b int) bool {
+		return tests[a].path < tests[b].path
+	})
+	return tests, err
+}
+
+// runTest runs the golden tests in each directory against this executable,
+// with the same -vm and -max-depth flags
+func runTest(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	dirs := parseFlags(flags, args)
+	if len(dirs) == 0 {
+		return fmt.Errorf("usage: glox [-vm] test dir...")
+	}
+
+	interpreter, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	interpreterArgs := []string{fmt.Sprintf("-max-depth=%d", *maxDepth)}
+	if *useVM {
+		interpreterArgs = append(interpreterArgs, "-vm")
+	}
+
+	passed, failed := 0, 0
+	for _, dir := range dirs {
+		tests, err := findGoldenTests(dir, *useVM)
+		if err != nil {
+			return err
+		}
+
+		for _, test := range tests {
+			failures := test.run(interpreter, interpreterArgs, nil)
+			if len(failures) == 0 {
+				passed++
+				continue
+			}
+
+			failed++
+			fmt.Printf("FAIL %s\n", test.path)
+			for _, failure := range failures {
+				fmt.Printf("    %s\n", strings.ReplaceAll(failure, "\n", "\n    "))
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d test(s) failed", failed)
+	}
+	return nil
+}
+
+func splitLines(text string) []string {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// difference returns the items of a that aren't in b
+func difference(a []string, b []string) []string {
+	inB := make(map[string]bool)
+	for _, item := range b {
+		inB[item] = true
+	}
+	items := make([]string, 0)
+	for _, item := range a {
+		if !inB[item] {
+			items = append(items, item)
+		}
+	}
+	return items
+}
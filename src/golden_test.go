@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The golden tests run the test binary itself as the interpreter, which acts
+// like glox when this variable is set
+const interpreterEnv = "GLOX_TEST_INTERPRETER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(interpreterEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestExamples(t *testing.T) {
+	runGoldenTests(t, "../lox", false)
+}
+
+func TestExamplesVM(t *testing.T) {
+	runGoldenTests(t, "../lox", true)
+}
+
+func runGoldenTests(t *testing.T, dir string, vm bool) {
+	interpreter, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := make([]string, 0)
+	if vm {
+		args = append(args, "-vm")
+	}
+
+	tests, err := findGoldenTests(dir, vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(filepath.Base(test.path), func(t *testing.T) {
+			t.Parallel()
+			for _, failure := range test.run(interpreter, args, []string{interpreterEnv + "=1"}) {
+				t.Error(failure)
+			}
+		})
+	}
+}
+
+// writeGoldenTest parses a test script with the given source
+func writeGoldenTest(t *testing.T, source string, vm bool) *goldenTest {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.lox")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	test, err := parseGoldenTest(path, vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return test
+}
+
+func checkFailures(t *testing.T, failures []string, want []string) {
+	t.Helper()
+	if !reflect.DeepEqual(failures, want) {
+		t.Errorf("got failures %q, want %q", failures, want)
+	}
+}
+
+func TestParseGoldenTest(t *testing.T) {
+	test := writeGoldenTest(t, `print 1; // expect: 1
+print 2; // expect: 2
+var 1; // Error at '1': Expect variable name
+// [c line 7] Error: only on the VM
+// [java line 8] Error: only on the tree-walker
+`, false)
+	wantOutput := []goldenLine{{"1", 1}, {"2", 2}}
+	if !reflect.DeepEqual(test.output, wantOutput) {
+		t.Errorf("output = %v, want %v", test.output, wantOutput)
+	}
+	wantErrors := []string{"[line 3] Error at '1': Expect variable name", "[line 8] Error: only on the tree-walker"}
+	if !reflect.DeepEqual(test.compileErrors, wantErrors) {
+		t.Errorf("compile errors = %q, want %q", test.compileErrors, wantErrors)
+	}
+	if test.exitCode != 65 {
+		t.Errorf("exit code = %d, want 65", test.exitCode)
+	}
+
+	test = writeGoldenTest(t, "\nprint nil.x; // expect runtime error: Only instances have properties\n", false)
+	if test.runtimeError != "Only instances have properties" || test.runtimeErrorLine != 2 || test.exitCode != 70 {
+		t.Errorf("runtime error = %q on line %d with exit code %d", test.runtimeError, test.runtimeErrorLine, test.exitCode)
+	}
+
+	if writeGoldenTest(t, "// nontest\nprint 1; // expect: 1\n", false) != nil {
+		t.Error("a nontest file should be skipped")
+	}
+	if writeGoldenTest(t, "// java only\n", true) != nil {
+		t.Error("a java only file should be skipped on the VM")
+	}
+	if writeGoldenTest(t, "// java only\n", false) == nil {
+		t.Error("a java only file should run on the tree-walker")
+	}
+
+	path := filepath.Join(t.TempDir(), "both.lox")
+	err := os.WriteFile(path, []byte("var 1; // Error at '1': Expect variable name\nprint nil.x; // expect runtime error: Oops\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseGoldenTest(path, false); err == nil {
+		t.Error("expecting both compile and runtime errors should fail")
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	test := writeGoldenTest(t, "print 1; // expect: 1\nprint 2; // expect: 2\n", false)
+
+	checkFailures(t, test.checkOutput([]string{"1", "2"}), []string{})
+	checkFailures(t, test.checkOutput([]string{"1", "3"}), []string{
+		"Expected output '2' on line 2 and got '3'.",
+	})
+	checkFailures(t, test.checkOutput([]string{"1"}), []string{
+		"Missing expected output '2' on line 2.",
+	})
+	checkFailures(t, test.checkOutput([]string{"1", "2", "3"}), []string{
+		"Got output '3' when none was expected.",
+	})
+}
+
+func TestCheckCompileErrors(t *testing.T) {
+	test := writeGoldenTest(t, "var 1; // Error at '1': Expect variable name\n", false)
+
+	checkFailures(t, test.checkCompileErrors([]string{
+		"[line 1] Error at '1': Expect variable name",
+		" --> test.lox:1:5",
+	}), []string{})
+	checkFailures(t, test.checkCompileErrors([]string{
+		"[line 2] Error at '1': Expect variable name",
+	}), []string{
+		"Missing expected error: [line 1] Error at '1': Expect variable name",
+		"Unexpected error: [line 2] Error at '1': Expect variable name",
+	})
+	checkFailures(t, test.checkCompileErrors(nil), []string{
+		"Missing expected error: [line 1] Error at '1': Expect variable name",
+	})
+}
+
+func TestCheckRuntimeError(t *testing.T) {
+	test := writeGoldenTest(t, "\nprint nil.x; // expect runtime error: Oops\n", false)
+
+	if failures := test.checkRuntimeError([]string{"Oops", "[line 2]"}); len(failures) > 0 {
+		t.Errorf("unexpected failures %q", failures)
+	}
+	checkFailures(t, test.checkRuntimeError([]string{"Oops", "[line 3]"}), []string{
+		"Expected runtime error on line 2 but was on line 3.",
+	})
+	checkFailures(t, test.checkRuntimeError([]string{"Oops"}), []string{
+		"Expected a line number after runtime error 'Oops'.",
+	})
+	checkFailures(t, test.checkRuntimeError(nil), []string{
+		"Expected runtime error 'Oops' and got none.",
+	})
+	checkFailures(t, test.checkRuntimeError([]string{"Other", "[line 2]"}), []string{
+		"Expected runtime error 'Oops' and got:\nOther\n[line 2]",
+	})
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/faideww/glox/src/ast"
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/scanner"
+	"github.com/faideww/glox/src/token"
+)
+
+// This file implements `glox lsp`, a Language Server Protocol server that
+// speaks JSON-RPC over stdin and stdout. Each open document is re-analyzed in
+// full whenever it changes; Lox files are small enough that this is instant.
+
+const (
+	lspParseError     = -32700
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+)
+
+// LSP's SymbolKind and DiagnosticSeverity values
+const (
+	lspSymbolClass    = 5
+	lspSymbolMethod   = 6
+	lspSymbolFunction = 12
+
+	lspSeverityError       = 1
+	lspSeverityWarning     = 2
+	lspSeverityInformation = 3
+)
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspTextDocumentPositionParams struct {
+	TextDocument lspTextDocumentItem `json:"textDocument"`
+	Position     lspPosition         `json:"position"`
+}
+
+type lspDiagnostic struct {
+	Range              lspRange                `json:"range"`
+	Severity           int                     `json:"severity"`
+	Code               string                  `json:"code,omitempty"`
+	Source             string                  `json:"source"`
+	Message            string                  `json:"message"`
+	RelatedInformation []lspRelatedInformation `json:"relatedInformation,omitempty"`
+}
+
+type lspRelatedInformation struct {
+	Location lspLocation `json:"location"`
+	Message  string      `json:"message"`
+}
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail,omitempty"`
+	Kind           int                 `json:"kind"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children"`
+}
+
+// lspDocument is an open file along with the results of analyzing it
+type lspDocument struct {
+	uri         string
+	lines       []string
+	index       *ast.SymbolIndex
+	diagnostics []lspDiagnostic
+}
+
+type lspServer struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]*lspDocument
+	shutdown  bool
+}
+
+func runLsp(r io.Reader, w io.Writer) error {
+	server := &lspServer{
+		reader:    bufio.NewReader(r),
+		writer:    w,
+		documents: make(map[string]*lspDocument),
+	}
+	return server.serve()
+}
+
+func (s *lspServer) serve() error {
+	for {
+		body, err := readMessage(s.reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var msg lspMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, &lspError{lspParseError, err.Error()})
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("received exit before shutdown")
+			}
+			return nil
+		}
+		s.handle(msg)
+	}
+}
+
+// readMessage reads one message body, framed by a Content-Length header. The
+// debug adapter protocol frames its messages the same way.
+func readMessage(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length '%s'", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message has no Content-Length header")
+	}
+
+	body := make([]byte, length)
+	_, err := io.ReadFull(reader, body)
+	return body, err
+}
+
+func writeMessage(writer io.Writer, body []byte) {
+	fmt.Fprintf(writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *lspServer) send(msg lspMessage) {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	writeMessage(s.writer, body)
+}
+
+func (s *lspServer) reply(id *json.RawMessage, result interface{}, err *lspError) {
+	if id == nil {
+		// notifications never get a response
+		return
+	}
+	if result == nil && err == nil {
+		// a missing result means "no result", which must be sent as null
+		result = json.RawMessage("null")
+	}
+	s.send(lspMessage{ID: id, Result: result, Error: err})
+}
+
+func (s *lspServer) notify(method string, params interface{}) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.send(lspMessage{Method: method, Params: body})
+}
+
+func (s *lspServer) handle(msg lspMessage) {
+	var result interface{}
+	var err *lspError
+
+	switch msg.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// documents are always sent in full
+				"textDocumentSync":       1,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "glox"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument lspTextDocumentItem `json:"textDocument"`
+		}
+		if err = decodeParams(msg.Params, &params); err == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   lspTextDocumentItem `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err = decodeParams(msg.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			changes := params.ContentChanges
+			s.update(params.TextDocument.URI, changes[len(changes)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument lspTextDocumentItem `json:"textDocument"`
+		}
+		if err = decodeParams(msg.Params, &params); err == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.publishDiagnostics(params.TextDocument.URI, []lspDiagnostic{})
+		}
+	case "textDocument/definition":
+		var params lspTextDocumentPositionParams
+		if err = decodeParams(msg.Params, &params); err == nil {
+			result = s.definition(params)
+		}
+	case "textDocument/references":
+		var params struct {
+			lspTextDocumentPositionParams
+			Context struct {
+				IncludeDeclaration bool `json:"includeDeclaration"`
+			} `json:"context"`
+		}
+		if err = decodeParams(msg.Params, &params); err == nil {
+			result = s.references(params.lspTextDocumentPositionParams, params.Context.IncludeDeclaration)
+		}
+	case "textDocument/hover":
+		var params lspTextDocumentPositionParams
+		if err = decodeParams(msg.Params, &params); err == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/documentSymbol":
+		var params lspTextDocumentPositionParams
+		if err = decodeParams(msg.Params, &params); err == nil {
+			result = s.documentSymbols(params.TextDocument.URI)
+		}
+	default:
+		// unknown notifications (like "initialized") can safely be ignored
+		if msg.ID != nil {
+			err = &lspError{lspMethodNotFound, fmt.Sprintf("Unsupported method '%s'", msg.Method)}
+		}
+	}
+
+	s.reply(msg.ID, result, err)
+}
+
+func decodeParams(params json.RawMessage, v interface{}) *lspError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &lspError{lspInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+// update re-analyzes a document after it is opened or changed, and publishes
+// its diagnostics
+func (s *lspServer) update(uri string, text string) {
+	doc := analyzeDocument(uri, text)
+	s.documents[uri] = doc
+	s.publishDiagnostics(uri, doc.diagnostics)
+}
+
+func (s *lspServer) publishDiagnostics(uri string, diagnostics []lspDiagnostic) {
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": diagnostics,
+	})
+}
+
+// analyzeDocument runs the scanner, parser and resolver over a document. The
+// resolver runs even if the document doesn't parse, so that navigation keeps
+// working while it's being edited, but its errors are only reported for a
+// complete program.
+func analyzeDocument(uri string, text string) *lspDocument {
+	doc := &lspDocument{
+		uri:         uri,
+		lines:       strings.Split(text, "\n"),
+		index:       ast.NewSymbolIndex(),
+		diagnostics: make([]lspDiagnostic, 0),
+	}
+
+	reporter := errors.NewErrorReporter()
+	scan := scanner.NewScanner(text, uriToPath(uri), reporter)
+	tokens, scanOk := scan.ScanTokens()
+	parser := ast.NewParser(tokens, reporter)
+	statements, parseOk := parser.Parse()
+
+	resolveReporter := reporter
+	if !scanOk || !parseOk {
+		resolveReporter = errors.NewErrorReporter()
+	}
+	resolver := ast.NewResolver(ast.NewInterpreter(), resolveReporter)
+	resolver.SetSymbolIndex(doc.index)
+	resolver.Resolve(statements)
+
+	for _, err := range reporter.Errors() {
+		doc.diagnostics = append(doc.diagnostics, doc.diagnostic(err))
+	}
+	return doc
+}
+
+func (doc *lspDocument) diagnostic(err error) lspDiagnostic {
+	d := lspDiagnostic{
+		Severity: lspSeverityError,
+		Source:   "glox",
+		Message:  err.Error(),
+	}
+
+	if diagnostic, ok := err.(errors.Diagnostic); ok {
+		d.Range = doc.span(diagnostic.Position())
+	}
+
+	switch err := err.(type) {
+	case *errors.ScannerError:
+		d.Message = err.Message()
+	case *errors.ParserError:
+		d.Message = err.Message()
+	case *errors.AnalysisError:
+		d.Message = err.Message()
+		if err.Kind() != errors.WARN_NONE {
+			d.Code = err.Kind().String()
+		}
+		switch err.Severity() {
+		case errors.SEVERITY_WARNING:
+			d.Severity = lspSeverityWarning
+		case errors.SEVERITY_NOTE:
+			d.Severity = lspSeverityInformation
+		}
+		for _, note := range err.Notes() {
+			d.RelatedInformation = append(d.RelatedInformation, lspRelatedInformation{
+				Location: lspLocation{doc.uri, doc.span(note.Position())},
+				Message:  note.Message(),
+			})
+		}
+	}
+	return d
+}
+
+// lspPosition converts a 1-based line and column (in characters) into an LSP
+// position, whose character offset is counted in UTF-16 code units
+func (doc *lspDocument) lspPosition(line int, column int) lspPosition {
+	text := doc.line(line)
+	units := 0
+	for j, r := range []rune(text) {
+		if j >= column-1 {
+			break
+		}
+		units += utf16Len(r)
+	}
+	return lspPosition{line - 1, units}
+}
+
+// column converts an LSP position back into a 1-based line and column
+func (doc *lspDocument) column(pos lspPosition) (int, int) {
+	text := doc.line(pos.Line + 1)
+	units := 0
+	column := 1
+	for _, r := range text {
+		if units >= pos.Character {
+			break
+		}
+		units += utf16Len(r)
+		column++
+	}
+	return pos.Line + 1, column
+}
+
+// utf16Len returns the number of UTF-16 code units needed to encode r
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func (doc *lspDocument) line(line int) string {
+	if line < 1 || line > len(doc.lines) {
+		return ""
+	}
+	return strings.TrimSuffix(doc.lines[line-1], "\r")
+}
+
+// span returns the range covered by a token. Tokens spanning several lines
+// are cut off at the end of their first line.
+func (doc *lspDocument) span(pos token.Position) lspRange {
+	if pos.Line < 1 {
+		return lspRange{}
+	}
+
+	width := 1
+	if pos.Source != nil && pos.End > pos.Start {
+		width = utf8.RuneCountInString(pos.Source.Text[pos.Start:pos.End])
+	}
+	lineLength := utf8.RuneCountInString(doc.line(pos.Line))
+	end := pos.Column + width
+	if end > lineLength+1 {
+		end = lineLength + 1
+	}
+	return lspRange{doc.lspPosition(pos.Line, pos.Column), doc.lspPosition(pos.Line, end)}
+}
+
+func (doc *lspDocument) location(t token.Token) lspLocation {
+	return lspLocation{doc.uri, doc.span(t.Position)}
+}
+
+// lookup finds the symbol or reference under the cursor
+func (s *lspServer) lookup(params lspTextDocumentPositionParams) (*lspDocument, *ast.Symbol, *ast.Reference) {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, nil, nil
+	}
+	line, column := doc.column(params.Position)
+	symbol, ref := doc.index.At(line, column)
+	return doc, symbol, ref
+}
+
+func (s *lspServer) definition(params lspTextDocumentPositionParams) interface{} {
+	doc, symbol, ref := s.lookup(params)
+	if doc == nil {
+		return nil
+	}
+
+	locations := make([]lspLocation, 0)
+	if symbol != nil {
+		locations = append(locations, doc.location(symbol.Name))
+	} else if ref != nil {
+		for _, definition := range doc.index.Definitions(ref) {
+			locations = append(locations, doc.location(definition.Name))
+		}
+	}
+	if len(locations) == 0 {
+		return nil
+	}
+	return locations
+}
+
+func (s *lspServer) references(params lspTextDocumentPositionParams, includeDeclaration bool) interface{} {
+	doc, symbol, ref := s.lookup(params)
+	if doc == nil {
+		return nil
+	}
+
+	targets := make([]*ast.Symbol, 0)
+	if symbol != nil {
+		targets = append(targets, symbol)
+	} else if ref != nil {
+		targets = doc.index.Definitions(ref)
+	}
+
+	locations := make([]lspLocation, 0)
+	seen := make(map[token.Position]bool)
+	add := func(t token.Token) {
+		if !seen[t.Position] {
+			seen[t.Position] = true
+			locations = append(locations, doc.location(t))
+		}
+	}
+	for _, target := range targets {
+		if includeDeclaration {
+			add(target.Name)
+		}
+		for _, r := range doc.index.ReferencesTo(target) {
+			add(r.Name)
+		}
+	}
+	return locations
+}
+
+func (s *lspServer) hover(params lspTextDocumentPositionParams) interface{} {
+	doc, symbol, ref := s.lookup(params)
+	if doc == nil || (symbol == nil && ref == nil) {
+		return nil
+	}
+
+	var name token.Token
+	descriptions := make([]string, 0)
+	if symbol != nil {
+		name = symbol.Name
+		descriptions = append(descriptions, symbol.Describe())
+	} else {
+		name = ref.Name
+		for _, definition := range doc.index.Definitions(ref) {
+			descriptions = append(descriptions, definition.Describe())
+		}
+		if len(descriptions) == 0 && ref.Member {
+			descriptions = append(descriptions, fmt.Sprintf("(property) %s", name.Lexeme))
+		} else if len(descriptions) == 0 {
+			// natives and anything defined by another file
+			descriptions = append(descriptions, fmt.Sprintf("(global) %s", name.Lexeme))
+		}
+	}
+
+	return map[string]interface{}{
+		"contents": map[string]string{
+			"kind":  "markdown",
+			"value": fmt.Sprintf("```lox\n%s\n```", strings.Join(descriptions, "\n")),
+		},
+		"range": doc.span(name.Position),
+	}
+}
+
+func (s *lspServer) documentSymbols(uri string) interface{} {
+	doc, ok := s.documents[uri]
+	if !ok {
+		return nil
+	}
+	return doc.documentSymbols(doc.index.Outline())
+}
+
+func (doc *lspDocument) documentSymbols(symbols []*ast.Symbol) []lspDocumentSymbol {
+	result := make([]lspDocumentSymbol, 0, len(symbols))
+	for _, symbol := range symbols {
+		kind := lspSymbolFunction
+		switch symbol.Kind {
+		case ast.SYMBOL_CLASS:
+			kind = lspSymbolClass
+		case ast.SYMBOL_METHOD:
+			kind = lspSymbolMethod
+		}
+		span := doc.span(symbol.Name.Position)
+		result = append(result, lspDocumentSymbol{
+			Name:           symbol.Name.Lexeme,
+			Detail:         symbol.Describe(),
+			Kind:           kind,
+			Range:          span,
+			SelectionRange: span,
+			Children:       doc.documentSymbols(symbol.Children),
+		})
+	}
+	return result
+}
+
+// uriToPath converts a file:// URI into a path for error messages, leaving
+// any other kind of URI as it is
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return parsed.Path
+}
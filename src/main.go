@@ -2,23 +2,69 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 
 	"github.com/faideww/glox/src/ast"
 	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/scanner"
+	"github.com/faideww/glox/src/vm"
 )
 
 var interpreter *ast.Interpreter
+var machine *vm.VM
+
+var useVM = flag.Bool("vm", false, "run programs on the bytecode VM instead of the tree-walking interpreter")
+var maxDepth = flag.Int("max-depth", ast.DEFAULT_MAX_CALL_DEPTH, "maximum call depth before a stack overflow error")
+var warningsAsErrors = flag.Bool("Werror", false, "treat warnings as errors")
+var diagnosticsFormat = flag.String("diagnostics", "text", "format of error messages: text, or json (written to stderr)")
+var profilePath = flag.String("profile", "", "profile the script, printing a summary to stderr and writing folded stacks for flame graphs to this file")
+var pprofPath = flag.String("pprof", "", "profile the script, printing a summary to stderr and writing the profile in pprof format to this file")
+
+// each kind of warning can be turned off with -Wno-<kind>
+var suppressedWarnings = make(map[errors.WarningKind]*bool)
+
+func init() {
+	for _, kind := range errors.WarningKinds() {
+		suppressedWarnings[kind] = flag.Bool(fmt.Sprintf("Wno-%s", kind), false, fmt.Sprintf("suppress %s warnings", kind))
+	}
+}
 
 func main() {
-	var err error
-	if len(os.Args) > 2 {
-		fmt.Printf("Usage: glox [script]\n")
+	flag.Parse()
+	args := flag.Args()
+
+	if *diagnosticsFormat != "text" && *diagnosticsFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown diagnostics format '%s'\n", *diagnosticsFormat)
 		os.Exit(64)
-	} else if len(os.Args) == 2 {
-		err = runFile(os.Args[1])
+	}
+	if *useVM && (*profilePath != "" || *pprofPath != "") {
+		fmt.Fprintln(os.Stderr, "Profiling is only supported by the tree-walking interpreter")
+		os.Exit(64)
+	}
+
+	var err error
+	if len(args) >= 1 && args[0] == "lsp" {
+		runCommand(runLsp(os.Stdin, os.Stdout))
+	} else if len(args) >= 1 && args[0] == "fmt" {
+		runCommand(runFmt(args[1:]))
+	} else if len(args) >= 1 && args[0] == "ast" {
+		runCommand(runAst(args[1:]))
+	} else if len(args) >= 1 && args[0] == "tokens" {
+		runCommand(runTokens(args[1:]))
+	} else if len(args) >= 1 && args[0] == "test" {
+		runCommand(runTest(args[1:]))
+	} else if len(args) >= 1 && args[0] == "debug" {
+		runCommand(runDebug(args[1:]))
+	} else if len(args) >= 1 && args[0] == "dap" {
+		runCommand(runDap(os.Stdin, os.Stdout))
+	} else if len(args) >= 1 {
+		// anything after the script is passed through to os.args()
+		err = runFile(args[0], args[1:])
 	} else {
 		err = runPrompt()
 	}
@@ -28,25 +74,105 @@ func main() {
 	}
 }
 
-func runFile(fp string) error {
+// runCommand exits after a subcommand has finished, reporting its error if it
+// failed
+func runCommand(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// parseFlags parses a subcommand's flags, which may come before or after its
+// file arguments, and returns the files
+func parseFlags(flags *flag.FlagSet, args []string) []string {
+	files := make([]string, 0)
+	flags.Parse(args)
+	for flags.NArg() > 0 {
+		files = append(files, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+	return files
+}
+
+func runFile(fp string, scriptArgs []string) error {
 	bytes, err := os.ReadFile(fp)
 	if err != nil {
 		return err
 	}
-	interpreter = ast.NewInterpreter()
-	err = runProgram(string(bytes))
-	if _, ok := err.(*errors.ParserError); ok {
+	options := []ast.InterpreterOption{ast.WithArgs(scriptArgs), ast.WithMaxCallDepth(*maxDepth)}
+	var profiler *ast.Profiler
+	if *profilePath != "" || *pprofPath != "" {
+		profiler = ast.NewProfiler()
+		options = append(options, ast.WithProfiler(profiler))
+	}
+	interpreter = ast.NewInterpreter(options...)
+	interpreter.SetModuleLoader(fp, loadModule)
+	machine = vm.NewVM()
+	err = runProgram(context.Background(), string(bytes), fp)
+	if profiler != nil {
+		// the profile is written even if the program failed part way through
+		profileErr := writeProfile(profiler)
+		if profileErr != nil {
+			return profileErr
+		}
+	}
+	if exit, ok := err.(*ast.ExitException); ok {
+		os.Exit(exit.Code())
+	}
+	switch err.(type) {
+	case *errors.ScannerError, *errors.ParserError, *errors.AnalysisError:
 		os.Exit(65)
 	}
 	if _, ok := err.(*errors.RuntimeError); ok {
 		os.Exit(70)
 	}
+	if _, ok := err.(*ast.ThrowException); ok {
+		os.Exit(70)
+	}
+	return nil
+}
+
+// writeProfile prints the profile's summary, and writes it out in the formats
+// chosen by the -profile and -pprof flags
+func writeProfile(profiler *ast.Profiler) error {
+	profiler.WriteSummary(os.Stderr)
+
+	if *profilePath != "" {
+		folded, err := os.Create(*profilePath)
+		if err != nil {
+			return err
+		}
+		profiler.WriteFolded(folded)
+		err = folded.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if *pprofPath != "" {
+		pprof, err := os.Create(*pprofPath)
+		if err != nil {
+			return err
+		}
+		err = profiler.WritePprof(pprof)
+		if err != nil {
+			pprof.Close()
+			return err
+		}
+		return pprof.Close()
+	}
 	return nil
 }
 
 func runPrompt() error {
+	// the prompt and io.readLine() share a reader, so that neither buffers
+	// input meant for the other
 	buffer := bufio.NewReader(os.Stdin)
-	interpreter = ast.NewInterpreter()
+	interpreter = ast.NewInterpreter(ast.WithMaxCallDepth(*maxDepth), ast.WithStdin(buffer))
+	interpreter.SetModuleLoader("", loadModule)
+	machine = vm.NewVM()
 
 	for {
 		var err error
@@ -58,19 +184,34 @@ func runPrompt() error {
 			return err
 		}
 
-		runRepl(line)
+		err = runInput(line)
+		if exit, ok := err.(*ast.ExitException); ok {
+			os.Exit(exit.Code())
+		}
 	}
 	return nil
 }
 
-func runRepl(source string) error {
-	scanner := NewScanner(source)
-	tokens, scanErr := scanner.ScanTokens()
-	if scanErr != nil {
-		return scanErr
+// runInput runs one line of REPL input. Ctrl-C interrupts it and returns to
+// the prompt, except on the VM, which can't be interrupted and so still exits.
+func runInput(line string) error {
+	if *useVM {
+		return runRepl(context.Background(), line)
 	}
 
-	reporter := errors.NewErrorReporter()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return runRepl(ctx, line)
+}
+
+func runRepl(ctx context.Context, source string) error {
+	reporter := newReporter()
+	scan := scanner.NewScanner(source, "<stdin>", reporter)
+	tokens, scanOk := scan.ScanTokens()
+	if !scanOk {
+		report(reporter)
+		return reporter.Last()
+	}
 
 	parser := ast.NewParser(tokens, reporter)
 
@@ -79,8 +220,16 @@ func runRepl(source string) error {
 
 	if parseOk {
 		// fmt.Printf("Expr: %+v\n", expr)
-		value, runtimeErr := interpreter.InterpretExpression(expr)
+		if *useVM {
+			return runCompiledExpression(expr)
+		}
+
+		value, runtimeErr := interpreter.InterpretExpression(ctx, expr)
+		if _, ok := runtimeErr.(*ast.ExitException); ok {
+			return runtimeErr
+		}
 		if runtimeErr != nil {
+			reportError(runtimeErr)
 			return runtimeErr
 		}
 
@@ -90,43 +239,148 @@ func runRepl(source string) error {
 
 	// if that fails, try to parse it as statements instead
 	reporter.Clear()
-	return runProgram(source)
+	return runProgram(ctx, source, "<stdin>")
 }
 
-func runProgram(source string) error {
-	scanner := NewScanner(source)
-	tokens, scanErr := scanner.ScanTokens()
-	if scanErr != nil {
-		return scanErr
+func runProgram(ctx context.Context, source string, filename string) error {
+	reporter := newReporter()
+	statements, ok := analyze(source, filename, reporter)
+	// warnings are printed even if the program goes on to run
+	report(reporter)
+	if !ok {
+		return reporter.Last()
+	}
+
+	if *useVM {
+		return runCompiled(statements)
 	}
 
+	runtimeErr := interpreter.Interpret(ctx, statements)
+	if _, ok := runtimeErr.(*ast.ExitException); ok {
+		return runtimeErr
+	}
+	if runtimeErr != nil {
+		reportError(runtimeErr)
+		return runtimeErr
+	}
+
+	return nil
+}
+
+func runCompiled(statements []ast.Stmt) error {
+	script, compileErr := ast.Compile(statements)
+	if compileErr != nil {
+		reportError(compileErr)
+		return compileErr
+	}
+
+	_, runtimeErr := machine.Interpret(script)
+	if runtimeErr != nil {
+		reportError(runtimeErr)
+		return runtimeErr
+	}
+
+	return nil
+}
+
+func runCompiledExpression(expr ast.Expr) error {
+	script, compileErr := ast.CompileExpression(expr)
+	if compileErr != nil {
+		reportError(compileErr)
+		return compileErr
+	}
+
+	value, runtimeErr := machine.Interpret(script)
+	if runtimeErr != nil {
+		reportError(runtimeErr)
+		return runtimeErr
+	}
+
+	fmt.Println(vm.Stringify(value))
+	return nil
+}
+
+// report prints every error and warning the reporter has collected, in the
+// format chosen by the -diagnostics flag
+func report(reporter *errors.ErrorReporter) {
+	if *diagnosticsFormat == "json" {
+		reporter.ReportJSON(os.Stderr)
+	} else {
+		reporter.Report(os.Stderr)
+	}
+}
+
+// reportError prints an error raised after analysis, either while compiling
+// for the VM or at runtime. Runtime errors raised inside a function are
+// printed with a traceback.
+func reportError(err error) {
+	if throw, ok := err.(*ast.ThrowException); ok {
+		err = throw.RuntimeError()
+	}
+
+	if *diagnosticsFormat == "json" {
+		reporter := newReporter()
+		reporter.Collect(err)
+		reporter.ReportJSON(os.Stderr)
+		return
+	}
+
+	if runtimeErr, ok := err.(*errors.RuntimeError); ok {
+		fmt.Fprint(os.Stderr, runtimeErr.Traceback())
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
+// newReporter creates an error reporter configured by the warning flags
+func newReporter() *errors.ErrorReporter {
 	reporter := errors.NewErrorReporter()
+	reporter.SetWarningsAsErrors(*warningsAsErrors)
+	for kind, suppressed := range suppressedWarnings {
+		if *suppressed {
+			reporter.Suppress(kind)
+		}
+	}
+	return reporter
+}
+
+// analyze scans, parses and resolves a program, collecting every error from
+// each phase into the reporter. The parser still runs if the scanner found
+// errors, but the resolver only runs on a program that parsed successfully,
+// since statements dropped by the parser would lead to spurious errors.
+func analyze(source string, filename string, reporter *errors.ErrorReporter) ([]ast.Stmt, bool) {
+	scan := scanner.NewScanner(source, filename, reporter)
+	tokens, scanOk := scan.ScanTokens()
+
 	parser := ast.NewParser(tokens, reporter)
 	statements, parseOk := parser.Parse()
+	if !scanOk || !parseOk {
+		return nil, false
+	}
 
 	// fmt.Println("Stmts:")
 	// for _, statement := range statements {
 	// 	fmt.Printf("%#v\n", statement)
 	// }
 
-	if !parseOk {
-		reporter.Report(os.Stdout)
-		return reporter.Last()
-	}
-
-	resolver := ast.NewResolver(interpreter)
-	resolveErr := resolver.Resolve(statements)
+	resolver := ast.NewResolver(interpreter, reporter)
+	resolveOk := resolver.Resolve(statements)
+	return statements, resolveOk
+}
 
-	if resolveErr != nil {
-		fmt.Println(resolveErr)
-		return resolveErr
+// loadModule prepares an imported file for the interpreter, which has already
+// switched into the new module's scope by the time this is called
+func loadModule(path string) ([]ast.Stmt, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
 
-	runtimeErr := interpreter.Interpret(statements)
-	if runtimeErr != nil {
-		fmt.Println(runtimeErr)
-		return runtimeErr
+	reporter := newReporter()
+	statements, ok := analyze(string(bytes), path, reporter)
+	if !ok {
+		return nil, reporter.Err()
 	}
+	report(reporter)
 
-	return nil
+	return statements, nil
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPromptReadLine(t *testing.T) {
+	interpreter, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the line after the call is read by io.readLine(), not run by the REPL
+	cmd := exec.Command(interpreter)
+	cmd.Env = append(os.Environ(), interpreterEnv+"=1")
+	cmd.Stdin = strings.NewReader("var name = io.readLine();\nlox\nprint \"hello \" + name;\n")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "> > hello lox\n> "; string(out) != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestPprofWithoutProfile(t *testing.T) {
+	interpreter, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.lox")
+	if err := os.WriteFile(script, []byte("fun f() { return 1; }\nprint f();\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pprof := filepath.Join(dir, "out.pb.gz")
+
+	cmd := exec.Command(interpreter, "-pprof", pprof, script)
+	cmd.Env = append(os.Environ(), interpreterEnv+"=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s:\n%s", err, out)
+	}
+
+	file, err := os.Open(pprof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := gzip.NewReader(file); err != nil {
+		t.Errorf("the profile isn't gzipped: %s", err)
+	}
+}
+
+func TestDebugSession(t *testing.T) {
+	interpreter, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	source := "fun add(a, b) {\n  var sum = a + b;\n  return sum;\n}\nprint add(1, 2);\n"
+	if err := os.WriteFile(filepath.Join(dir, "debug.lox"), []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(interpreter, "debug", "debug.lox")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), interpreterEnv+"=1")
+	cmd.Stdin = strings.NewReader("b 3\nc\np sum a\nbt\nv\nn\n")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Paused at debug.lox:1
+    1 | fun add(a, b) {
+(debug) Breakpoint set at debug.lox:3.
+(debug) Paused at debug.lox:3 (breakpoint)
+    3 |   return sum;
+(debug) sum = 3
+a = 1
+(debug)   #0 add at debug.lox:3
+  #1 <script> at debug.lox:5
+(debug) local:
+  a = 1
+  b = 2
+  sum = 3
+global:
+  add = <fn add>
+(debug) 3
+Program finished.
+`
+	if string(out) != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
@@ -1,82 +1,102 @@
-package main
+package scanner
 
 import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/faideww/glox/src/errors"
 	"github.com/faideww/glox/src/token"
 )
 
 type Scanner struct {
 	source         string
+	file           *token.Source
 	tokens         []token.Token
+	comments       []token.Token
 	start          int
 	current        int
 	line           int
+	lineStart      int
+	startLine      int
+	startColumn    int
 	currentTokenId int
 	keywords       map[string]token.TokenType
+	reporter       *errors.ErrorReporter
+	errored        bool
 }
 
-type ScannerError struct {
-	line    int
-	where   string
-	message string
-}
-
-func (e *ScannerError) Error() string {
-	return fmt.Sprintf("[line %d] Error%s: %s", e.line, e.where, e.message)
-}
-
-func NewScanner(source string) *Scanner {
+func NewScanner(source string, filename string, reporter *errors.ErrorReporter) *Scanner {
 	return &Scanner{
 		source:         source,
+		file:           token.NewSource(filename, source),
 		tokens:         make([]token.Token, 0),
+		comments:       make([]token.Token, 0),
 		start:          0,
 		current:        0,
 		line:           1,
 		currentTokenId: 0,
 		keywords: map[string]token.TokenType{
 			"and":      token.AND,
+			"as":       token.AS,
 			"break":    token.BREAK,
+			"catch":    token.CATCH,
 			"class":    token.CLASS,
 			"continue": token.CONTINUE,
 			"else":     token.ELSE,
 			"false":    token.FALSE,
+			"finally":  token.FINALLY,
 			"fun":      token.FUN,
 			"for":      token.FOR,
 			"if":       token.IF,
+			"import":   token.IMPORT,
 			"nil":      token.NIL,
 			"or":       token.OR,
 			"print":    token.PRINT,
 			"return":   token.RETURN,
 			"super":    token.SUPER,
 			"this":     token.THIS,
+			"throw":    token.THROW,
 			"true":     token.TRUE,
+			"try":      token.TRY,
 			"var":      token.VAR,
 			"while":    token.WHILE,
 		},
+		reporter: reporter,
 	}
 }
 
-func (s *Scanner) ScanTokens() ([]token.Token, error) {
-	var err error
-	for !s.atEnd() && err == nil {
-		s.start = s.current
-		err = s.scanToken()
-	}
-	if err != nil {
-		return s.tokens, err
+// ScanTokens scans the whole source, reporting every error it finds along the
+// way. The tokens are returned even if there were errors, so that the parser
+// can report its own errors too.
+func (s *Scanner) ScanTokens() ([]token.Token, bool) {
+	for !s.atEnd() {
+		s.startToken()
+		s.scanToken()
 	}
-	s.tokens = append(s.tokens, token.NewToken(token.EOF, "", nil, s.line, s.currentTokenId))
-	return s.tokens, nil
+	s.startToken()
+	s.tokens = append(s.tokens, token.NewToken(token.EOF, "", nil, s.position(), s.currentTokenId))
+	return s.tokens, !s.errored
+}
+
+// Comments returns the comments found by ScanTokens, in the order they appear.
+// They aren't part of the token stream, since the parser has no use for them,
+// but tools like the formatter need to put them back.
+func (s *Scanner) Comments() []token.Token {
+	return s.comments
+}
+
+func (s *Scanner) error(message string) {
+	s.errored = true
+	s.reporter.Collect(errors.NewScannerError(s.position(), message))
 }
 
 func (s *Scanner) atEnd() bool {
 	return s.current >= len(s.source)
 }
 
-func (s *Scanner) scanToken() error {
+func (s *Scanner) scanToken() {
 	c := s.advance()
 	switch c {
 	case '(':
@@ -87,6 +107,10 @@ func (s *Scanner) scanToken() error {
 		s.addToken(token.LEFT_BRACE)
 	case '}':
 		s.addToken(token.RIGHT_BRACE)
+	case '[':
+		s.addToken(token.LEFT_BRACKET)
+	case ']':
+		s.addToken(token.RIGHT_BRACKET)
 	case ',':
 		s.addToken(token.COMMA)
 	case '.':
@@ -131,8 +155,8 @@ func (s *Scanner) scanToken() error {
 		if s.match('/') {
 			for s.peek() != '\n' && !s.atEnd() {
 				s.advance()
-				// comments are ignored in the parser, so we don't add a token for them
 			}
+			s.addComment()
 		} else if s.match('*') {
 			nestLevel := 1
 			for nestLevel > 0 && !s.atEnd() {
@@ -143,8 +167,8 @@ func (s *Scanner) scanToken() error {
 				} else {
 					s.advance()
 				}
-				// comments are ignored
 			}
+			s.addComment()
 		} else {
 			s.addToken(token.SLASH)
 		}
@@ -155,40 +179,68 @@ func (s *Scanner) scanToken() error {
 	case '\t':
 		break
 	case '\n':
-		s.line++
+		break
 	case '"':
-		err := s.string()
-		if err != nil {
-			return err
-		}
+		s.string()
 	default:
 		if isDigit(c) {
 			s.number()
 		} else if isAlpha(c) {
 			s.identifier()
 		} else {
-			return &ScannerError{s.line, "", fmt.Sprintf("Unexpected character '%s'\n", string(c))}
+			s.error(fmt.Sprintf("Unexpected character '%s'", string(c)))
 		}
 	}
-	return nil
 }
 
 func (s *Scanner) advance() rune {
 	r := s.source[s.current]
 	s.current++
+	if r == '\n' {
+		s.line++
+		s.lineStart = s.current
+	}
 	return rune(r)
 }
 
+// Marks the current character as the start of the next token
+func (s *Scanner) startToken() {
+	s.start = s.current
+	s.startLine = s.line
+	s.startColumn = utf8.RuneCountInString(s.source[s.lineStart:s.start]) + 1
+}
+
+// Returns the position of the token currently being scanned. Tokens that span
+// several lines (like strings) are positioned at the line they start on.
+func (s *Scanner) position() token.Position {
+	return token.Position{
+		Line:   s.startLine,
+		Column: s.startColumn,
+		Start:  s.start,
+		End:    s.current,
+		Source: s.file,
+	}
+}
+
 func (s *Scanner) addToken(t token.TokenType) {
 	s.addTokenWithLiteral(t, nil)
 }
 
 func (s *Scanner) addTokenWithLiteral(t token.TokenType, literal token.LiteralObject) {
 	text := s.source[s.start:s.current]
-	s.tokens = append(s.tokens, token.NewToken(t, text, literal, s.line, s.currentTokenId))
+	s.tokens = append(s.tokens, token.NewToken(t, text, literal, s.position(), s.currentTokenId))
 	s.currentTokenId++
 }
 
+// addComment keeps a comment aside from the tokens, since the parser ignores
+// them
+func (s *Scanner) addComment() {
+	text := strings.TrimRight(s.source[s.start:s.current], "\r")
+	position := s.position()
+	position.End = s.start + len(text)
+	s.comments = append(s.comments, token.NewToken(token.COMMENT, text, nil, position, s.currentTokenId))
+}
+
 func (s *Scanner) match(expected rune) bool {
 	if s.atEnd() {
 		return false
@@ -215,22 +267,19 @@ func (s *Scanner) peekNext() rune {
 	return rune(s.source[s.current+1])
 }
 
-func (s *Scanner) string() error {
+func (s *Scanner) string() {
 	for s.peek() != '"' && !s.atEnd() {
-		if s.peek() == '\n' {
-			s.line++
-		}
 		s.advance()
 	}
 	if s.atEnd() {
-		return &ScannerError{s.line, "", "Unterminated string"}
+		s.error("Unterminated string")
+		return
 	}
 
 	s.advance()
 
 	str := s.source[s.start+1 : s.current-1]
 	s.addTokenWithLiteral(token.STRING, str)
-	return nil
 }
 
 func isDigit(c rune) bool {
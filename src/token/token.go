@@ -1,6 +1,9 @@
 package token
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type TokenType int
 
@@ -10,6 +13,8 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	LEFT_BLOCK_COMMENT
 	RIGHT_BLOCK_COMMENT
 	COMMA
@@ -39,41 +44,154 @@ const (
 
 	// keywords
 	AND
+	AS
 	BREAK
+	CATCH
 	CLASS
 	CONTINUE
 	ELSE
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IMPORT
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
 	TRUE
+	TRY
 	VAR
 	WHILE
 
+	// trivia, which the scanner keeps apart from the tokens it returns
+	COMMENT
+
 	EOF
 )
 
+var tokenTypeNames = map[TokenType]string{
+	LEFT_PAREN:          "LEFT_PAREN",
+	RIGHT_PAREN:         "RIGHT_PAREN",
+	LEFT_BRACE:          "LEFT_BRACE",
+	RIGHT_BRACE:         "RIGHT_BRACE",
+	LEFT_BRACKET:        "LEFT_BRACKET",
+	RIGHT_BRACKET:       "RIGHT_BRACKET",
+	LEFT_BLOCK_COMMENT:  "LEFT_BLOCK_COMMENT",
+	RIGHT_BLOCK_COMMENT: "RIGHT_BLOCK_COMMENT",
+	COMMA:               "COMMA",
+	DOT:                 "DOT",
+	MINUS:               "MINUS",
+	PLUS:                "PLUS",
+	SEMICOLON:           "SEMICOLON",
+	SLASH:               "SLASH",
+	STAR:                "STAR",
+	QMARK:               "QMARK",
+	COLON:               "COLON",
+	BANG:                "BANG",
+	BANG_EQUAL:          "BANG_EQUAL",
+	EQUAL:               "EQUAL",
+	EQUAL_EQUAL:         "EQUAL_EQUAL",
+	GREATER:             "GREATER",
+	GREATER_EQUAL:       "GREATER_EQUAL",
+	LESS:                "LESS",
+	LESS_EQUAL:          "LESS_EQUAL",
+	IDENTIFIER:          "IDENTIFIER",
+	STRING:              "STRING",
+	NUMBER:              "NUMBER",
+	AND:                 "AND",
+	AS:                  "AS",
+	BREAK:               "BREAK",
+	CATCH:               "CATCH",
+	CLASS:               "CLASS",
+	CONTINUE:            "CONTINUE",
+	ELSE:                "ELSE",
+	FALSE:               "FALSE",
+	FINALLY:             "FINALLY",
+	FUN:                 "FUN",
+	FOR:                 "FOR",
+	IF:                  "IF",
+	IMPORT:              "IMPORT",
+	NIL:                 "NIL",
+	OR:                  "OR",
+	PRINT:               "PRINT",
+	RETURN:              "RETURN",
+	SUPER:               "SUPER",
+	THIS:                "THIS",
+	THROW:               "THROW",
+	TRUE:                "TRUE",
+	TRY:                 "TRY",
+	VAR:                 "VAR",
+	WHILE:               "WHILE",
+	COMMENT:             "COMMENT",
+	EOF:                 "EOF",
+}
+
+func (t TokenType) String() string {
+	if name, ok := tokenTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
 type LiteralObject interface{}
 
+// A Source is the text of a file (or a line of REPL input) that tokens were
+// scanned from
+type Source struct {
+	Name string
+	Text string
+}
+
+func NewSource(name string, text string) *Source {
+	return &Source{name, text}
+}
+
+// LineText returns the given 1-based line of the source, without its newline
+func (s *Source) LineText(line int) string {
+	lines := strings.Split(s.Text, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line-1], "\r")
+}
+
+// Position locates a token in its source. Line and Column are 1-based, and the
+// column counts characters rather than bytes. Start and End are byte offsets
+// into the source text, with End being exclusive.
+type Position struct {
+	Line   int
+	Column int
+	Start  int
+	End    int
+	Source *Source
+}
+
+// File returns the name of the file the position is in, or an empty string for
+// tokens that don't come from a source file
+func (p Position) File() string {
+	if p.Source == nil {
+		return ""
+	}
+	return p.Source.Name
+}
+
 type Token struct {
 	TokenType TokenType
 	Lexeme    string
 	Literal   LiteralObject
-	Line      int
-	tokenId   int
+	Position
+	tokenId int
 }
 
-func NewToken(tokenType TokenType, lexeme string, literal LiteralObject, line int, tokenId int) Token {
-	return Token{tokenType, lexeme, literal, line, tokenId}
+func NewToken(tokenType TokenType, lexeme string, literal LiteralObject, position Position, tokenId int) Token {
+	return Token{tokenType, lexeme, literal, position, tokenId}
 }
 
 func (t Token) String() string {
-	return fmt.Sprintf("%d %s %x", t.TokenType, t.Lexeme, t.Literal)
+	return fmt.Sprintf("%s %s %v", t.TokenType, t.Lexeme, t.Literal)
 }
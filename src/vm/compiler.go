@@ -0,0 +1,433 @@
+package vm
+
+import (
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+)
+
+const maxLocals = 256
+const maxConstants = 256
+const maxJump = 0xffff
+
+type local struct {
+	name       string
+	depth      int
+	isCaptured bool
+}
+
+type upvalueRef struct {
+	index   byte
+	isLocal bool
+}
+
+type loopState struct {
+	enclosing  *loopState
+	start      int
+	scopeDepth int
+	breaks     []int
+}
+
+type functionState struct {
+	enclosing  *functionState
+	function   *Function
+	kind       FunctionKind
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+	loop       *loopState
+	pos        token.Position
+}
+
+// Compiler holds the state needed to emit bytecode for a single program in
+// one pass over its syntax tree. The tree itself is walked by the ast package,
+// which calls back into the Compiler to emit instructions and manage scopes.
+type Compiler struct {
+	current *functionState
+}
+
+func NewCompiler() *Compiler {
+	c := &Compiler{}
+	c.beginFunctionState("", 0, FNKIND_SCRIPT)
+	return c
+}
+
+// Script returns the top-level function compiled so far. Callers are
+// responsible for emitting the final return instruction.
+func (c *Compiler) Script() *Function {
+	return c.current.function
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return &c.current.function.Chunk
+}
+
+func (c *Compiler) error(pos token.Position, message string) error {
+	return errors.NewAnalysisError(token.Token{Position: pos}, message)
+}
+
+// Position returns the source position of the most recently emitted
+// instruction, for use by synthesized instructions that have no token of their
+// own
+func (c *Compiler) Position() token.Position {
+	return c.current.pos
+}
+
+func (c *Compiler) emitByte(b byte, pos token.Position) {
+	c.current.pos = pos
+	c.chunk().write(b, pos)
+}
+
+func (c *Compiler) EmitOp(op OpCode, pos token.Position) {
+	c.emitByte(byte(op), pos)
+}
+
+func (c *Compiler) makeConstant(v Value, pos token.Position) (byte, error) {
+	index := c.chunk().addConstant(v)
+	if index >= maxConstants {
+		return 0, c.error(pos, "Too many constants in one chunk")
+	}
+	return byte(index), nil
+}
+
+func (c *Compiler) EmitConstant(v Value, pos token.Position) error {
+	index, err := c.makeConstant(v, pos)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(OP_CONSTANT, pos)
+	c.emitByte(index, pos)
+	return nil
+}
+
+// EmitNameOp emits an instruction whose operand is the name of a variable,
+// property or method, stored in the constant table
+func (c *Compiler) EmitNameOp(op OpCode, name token.Token) error {
+	index, err := c.makeConstant(name.Lexeme, name.Position)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(op, name.Position)
+	c.emitByte(index, name.Position)
+	return nil
+}
+
+func (c *Compiler) EmitCall(argCount int, pos token.Position) {
+	c.EmitOp(OP_CALL, pos)
+	c.emitByte(byte(argCount), pos)
+}
+
+func (c *Compiler) EmitBuildList(count int, pos token.Position) error {
+	if count > 255 {
+		return c.error(pos, "Too many elements in list literal")
+	}
+	c.EmitOp(OP_BUILD_LIST, pos)
+	c.emitByte(byte(count), pos)
+	return nil
+}
+
+func (c *Compiler) EmitBuildMap(count int, pos token.Position) error {
+	if count > 255 {
+		return c.error(pos, "Too many entries in map literal")
+	}
+	c.EmitOp(OP_BUILD_MAP, pos)
+	c.emitByte(byte(count), pos)
+	return nil
+}
+
+// EmitJump emits a forward jump with a placeholder offset, and returns the
+// position of the offset so that it can be filled in by PatchJump
+func (c *Compiler) EmitJump(op OpCode, pos token.Position) int {
+	c.EmitOp(op, pos)
+	c.emitByte(0xff, pos)
+	c.emitByte(0xff, pos)
+	return len(c.chunk().Code) - 2
+}
+
+func (c *Compiler) PatchJump(offset int) error {
+	code := c.chunk().Code
+	jump := len(code) - offset - 2
+	if jump > maxJump {
+		return c.error(c.chunk().Positions[offset], "Too much code to jump over")
+	}
+	code[offset] = byte(jump >> 8)
+	code[offset+1] = byte(jump)
+	return nil
+}
+
+// LoopStart returns the current position in the chunk, to be used as the
+// target of a later EmitLoop
+func (c *Compiler) LoopStart() int {
+	return len(c.chunk().Code)
+}
+
+func (c *Compiler) EmitLoop(start int, pos token.Position) error {
+	c.EmitOp(OP_LOOP, pos)
+	jump := len(c.chunk().Code) - start + 2
+	if jump > maxJump {
+		return c.error(pos, "Loop body too large")
+	}
+	c.emitByte(byte(jump>>8), pos)
+	c.emitByte(byte(jump), pos)
+	return nil
+}
+
+func (c *Compiler) BeginScope() {
+	c.current.scopeDepth++
+}
+
+func (c *Compiler) EndScope(pos token.Position) {
+	c.current.scopeDepth--
+	c.popLocals(c.current.scopeDepth, pos)
+	for len(c.current.locals) > 0 && c.current.locals[len(c.current.locals)-1].depth > c.current.scopeDepth {
+		c.current.locals = c.current.locals[:len(c.current.locals)-1]
+	}
+}
+
+// popLocals emits the instructions to discard every local deeper than depth,
+// without forgetting them at compile time. This is shared between EndScope
+// and break/continue, which jump out of scopes that are still being compiled.
+func (c *Compiler) popLocals(depth int, pos token.Position) {
+	for i := len(c.current.locals) - 1; i >= 0 && c.current.locals[i].depth > depth; i-- {
+		if c.current.locals[i].isCaptured {
+			c.EmitOp(OP_CLOSE_UPVALUE, pos)
+		} else {
+			c.EmitOp(OP_POP, pos)
+		}
+	}
+}
+
+func (c *Compiler) addLocal(name string, pos token.Position) error {
+	if len(c.current.locals) >= maxLocals {
+		return c.error(pos, "Too many local variables in function")
+	}
+	c.current.locals = append(c.current.locals, local{name, -1, false})
+	return nil
+}
+
+// DeclareVariable reserves a stack slot for a local variable. Globals are late
+// bound by name, so there is nothing to declare at the top level.
+func (c *Compiler) DeclareVariable(name token.Token) error {
+	if c.current.scopeDepth == 0 {
+		return nil
+	}
+	return c.addLocal(name.Lexeme, name.Position)
+}
+
+// DefineVariable makes a declared variable available for use. The variable's
+// initial value is expected to be on top of the stack.
+func (c *Compiler) DefineVariable(name token.Token) error {
+	if c.current.scopeDepth > 0 {
+		c.MarkInitialized()
+		return nil
+	}
+	return c.EmitNameOp(OP_DEFINE_GLOBAL, name)
+}
+
+// DefineLocal declares and immediately defines a local variable for the value
+// on top of the stack, for compiler-introduced names like "super"
+func (c *Compiler) DefineLocal(name string, pos token.Position) error {
+	err := c.addLocal(name, pos)
+	if err != nil {
+		return err
+	}
+	c.MarkInitialized()
+	return nil
+}
+
+// MarkInitialized makes the most recently declared local usable before its
+// value has been computed, so that functions can refer to themselves
+func (c *Compiler) MarkInitialized() {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+func resolveLocal(state *functionState, name string) int {
+	for i := len(state.locals) - 1; i >= 0; i-- {
+		if state.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Compiler) resolveUpvalue(state *functionState, name string, pos token.Position) (int, error) {
+	if state.enclosing == nil {
+		return -1, nil
+	}
+
+	if local := resolveLocal(state.enclosing, name); local != -1 {
+		state.enclosing.locals[local].isCaptured = true
+		return c.addUpvalue(state, byte(local), true, pos)
+	}
+
+	upvalue, err := c.resolveUpvalue(state.enclosing, name, pos)
+	if err != nil || upvalue == -1 {
+		return upvalue, err
+	}
+	return c.addUpvalue(state, byte(upvalue), false, pos)
+}
+
+func (c *Compiler) addUpvalue(state *functionState, index byte, isLocal bool, pos token.Position) (int, error) {
+	for i, upvalue := range state.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i, nil
+		}
+	}
+
+	if len(state.upvalues) >= maxLocals {
+		return -1, c.error(pos, "Too many closure variables in function")
+	}
+
+	state.upvalues = append(state.upvalues, upvalueRef{index, isLocal})
+	state.function.UpvalueCount = len(state.upvalues)
+	return len(state.upvalues) - 1, nil
+}
+
+func (c *Compiler) namedVariable(name token.Token, set bool) error {
+	getOp, setOp := OP_GET_LOCAL, OP_SET_LOCAL
+	arg := resolveLocal(c.current, name.Lexeme)
+	if arg == -1 {
+		var err error
+		arg, err = c.resolveUpvalue(c.current, name.Lexeme, name.Position)
+		if err != nil {
+			return err
+		}
+		getOp, setOp = OP_GET_UPVALUE, OP_SET_UPVALUE
+	}
+
+	if arg == -1 {
+		if set {
+			return c.EmitNameOp(OP_SET_GLOBAL, name)
+		}
+		return c.EmitNameOp(OP_GET_GLOBAL, name)
+	}
+
+	if set {
+		c.EmitOp(setOp, name.Position)
+	} else {
+		c.EmitOp(getOp, name.Position)
+	}
+	c.emitByte(byte(arg), name.Position)
+	return nil
+}
+
+// GetVariable emits an instruction to push the value of the named variable,
+// resolving it as a local, an upvalue or a global (in that order)
+func (c *Compiler) GetVariable(name token.Token) error {
+	return c.namedVariable(name, false)
+}
+
+// SetVariable emits an instruction to assign the value on top of the stack to
+// the named variable, leaving the value on the stack
+func (c *Compiler) SetVariable(name token.Token) error {
+	return c.namedVariable(name, true)
+}
+
+func (c *Compiler) beginFunctionState(name string, arity int, kind FunctionKind) {
+	state := &functionState{
+		enclosing: c.current,
+		function:  &Function{Name: name, Arity: arity},
+		kind:      kind,
+		locals:    make([]local, 0),
+		upvalues:  make([]upvalueRef, 0),
+	}
+	if c.current != nil {
+		state.pos = c.current.pos
+	}
+
+	// slot zero holds the function being called, or the receiver for methods
+	slotName := ""
+	if kind == FNKIND_METHOD || kind == FNKIND_INITIALIZER {
+		slotName = "this"
+	}
+	state.locals = append(state.locals, local{slotName, 0, false})
+
+	c.current = state
+}
+
+// BeginFunction starts compiling a new function body. Its parameters should
+// be declared and defined as locals before the body is compiled.
+func (c *Compiler) BeginFunction(name string, arity int, kind FunctionKind) {
+	c.beginFunctionState(name, arity, kind)
+	c.BeginScope()
+}
+
+// EndFunction finishes the current function body and emits a closure for it
+// into the enclosing function
+func (c *Compiler) EndFunction(pos token.Position) error {
+	c.EmitReturn(pos)
+
+	state := c.current
+	c.current = state.enclosing
+
+	index, err := c.makeConstant(state.function, pos)
+	if err != nil {
+		return err
+	}
+	c.EmitOp(OP_CLOSURE, pos)
+	c.emitByte(index, pos)
+	for _, upvalue := range state.upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		c.emitByte(isLocal, pos)
+		c.emitByte(upvalue.index, pos)
+	}
+	return nil
+}
+
+// EmitReturn emits a return with the implicit value for the current function:
+// the receiver for initializers, and nil for everything else
+func (c *Compiler) EmitReturn(pos token.Position) {
+	if c.current.kind == FNKIND_INITIALIZER {
+		c.EmitOp(OP_GET_LOCAL, pos)
+		c.emitByte(0, pos)
+	} else {
+		c.EmitOp(OP_NIL, pos)
+	}
+	c.EmitOp(OP_RETURN, pos)
+}
+
+func (c *Compiler) BeginLoop(start int) {
+	c.current.loop = &loopState{
+		enclosing:  c.current.loop,
+		start:      start,
+		scopeDepth: c.current.scopeDepth,
+		breaks:     make([]int, 0),
+	}
+}
+
+// EndLoop patches any pending break jumps to land after the loop
+func (c *Compiler) EndLoop() error {
+	loop := c.current.loop
+	c.current.loop = loop.enclosing
+	for _, offset := range loop.breaks {
+		err := c.PatchJump(offset)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) EmitBreak(pos token.Position) error {
+	loop := c.current.loop
+	if loop == nil {
+		return c.error(pos, "Can't break outside of loop")
+	}
+	c.popLocals(loop.scopeDepth, pos)
+	loop.breaks = append(loop.breaks, c.EmitJump(OP_JUMP, pos))
+	return nil
+}
+
+func (c *Compiler) EmitContinue(pos token.Position) error {
+	loop := c.current.loop
+	if loop == nil {
+		return c.error(pos, "Can't continue outside of loop")
+	}
+	c.popLocals(loop.scopeDepth, pos)
+	return c.EmitLoop(loop.start, pos)
+}
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+func (vm *VM) defineCollectionNatives() {
+	vm.DefineNative("len", 1, nativeLen)
+	vm.DefineNative("keys", 1, nativeKeys)
+	vm.DefineNative("values", 1, nativeValues)
+	vm.DefineNative("has", 2, nativeHas)
+	vm.DefineNative("remove", 2, nativeRemove)
+}
+
+func nativeLen(args []Value) (Value, error) {
+	switch v := args[0].(type) {
+	case *List:
+		return float64(len(v.elements)), nil
+	case *Map:
+		return float64(len(v.keys)), nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	}
+	return nil, fmt.Errorf("len() expects a list, map or string")
+}
+
+func mapArg(name string, arg Value) (*Map, error) {
+	m, ok := arg.(*Map)
+	if !ok {
+		return nil, fmt.Errorf("%s() expects a map", name)
+	}
+	return m, nil
+}
+
+func nativeKeys(args []Value) (Value, error) {
+	m, err := mapArg("keys", args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Value, len(m.keys))
+	copy(keys, m.keys)
+	return &List{keys}, nil
+}
+
+func nativeValues(args []Value) (Value, error) {
+	m, err := mapArg("values", args[0])
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Value, len(m.keys))
+	for j, key := range m.keys {
+		values[j] = m.entries[key]
+	}
+	return &List{values}, nil
+}
+
+func nativeHas(args []Value) (Value, error) {
+	m, err := mapArg("has", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.has(args[1]), nil
+}
+
+func nativeRemove(args []Value) (Value, error) {
+	m, err := mapArg("remove", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.remove(args[1]), nil
+}
@@ -0,0 +1,223 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Value interface{}
+
+type FunctionKind int
+
+const (
+	FNKIND_SCRIPT = iota
+	FNKIND_FUNCTION
+	FNKIND_METHOD
+	FNKIND_INITIALIZER
+)
+
+type Function struct {
+	Name         string
+	Arity        int
+	UpvalueCount int
+	Chunk        Chunk
+}
+
+func (f *Function) String() string {
+	if f.Name == "" {
+		return "<script>"
+	}
+	return fmt.Sprintf("<fn %s>", f.Name)
+}
+
+type nativeFn func(args []Value) (Value, error)
+
+type Native struct {
+	name  string
+	arity int
+	fn    nativeFn
+}
+
+func NewNative(name string, arity int, fn nativeFn) *Native {
+	return &Native{name, arity, fn}
+}
+
+func (n *Native) String() string {
+	return "<native function>"
+}
+
+// An Upvalue refers to a variable captured by a closure. While the variable is
+// still live on the VM stack the upvalue points at its slot; once the slot is
+// popped, the value is moved into the upvalue itself.
+type Upvalue struct {
+	slot   int
+	closed Value
+	open   bool
+	next   *Upvalue
+}
+
+type Closure struct {
+	function *Function
+	upvalues []*Upvalue
+}
+
+func (c *Closure) String() string {
+	return c.function.String()
+}
+
+type Class struct {
+	name    string
+	methods map[string]*Closure
+}
+
+func (c *Class) String() string {
+	return c.name
+}
+
+type Instance struct {
+	class  *Class
+	fields map[string]Value
+}
+
+func (i *Instance) String() string {
+	return fmt.Sprintf("%s instance", i.class.name)
+}
+
+type BoundMethod struct {
+	receiver Value
+	method   *Closure
+}
+
+func (b *BoundMethod) String() string {
+	return b.method.String()
+}
+
+type List struct {
+	elements []Value
+}
+
+func (l *List) String() string {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for j, element := range l.elements {
+		if j > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(Stringify(element))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// index converts a Lox value into a usable index into the list, or returns a
+// message explaining why it can't be used as one
+func (l *List) index(index Value) (int, string) {
+	fIndex, ok := index.(float64)
+	if !ok || fIndex != math.Trunc(fIndex) {
+		return 0, "List index must be an integer"
+	}
+
+	if fIndex < 0 || fIndex >= float64(len(l.elements)) {
+		return 0, fmt.Sprintf("List index %s out of range", Stringify(index))
+	}
+
+	return int(fIndex), ""
+}
+
+// Map mirrors the tree-walking interpreter's LoxMap: keys are strings, numbers
+// and booleans compared exactly as == compares them, and insertion order is
+// preserved for iteration
+type Map struct {
+	entries map[Value]Value
+	keys    []Value
+}
+
+func NewMap() *Map {
+	return &Map{make(map[Value]Value), make([]Value, 0)}
+}
+
+func isHashable(key Value) bool {
+	switch k := key.(type) {
+	case string, bool:
+		return true
+	case float64:
+		return !math.IsNaN(k)
+	}
+	return false
+}
+
+func (m *Map) String() string {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for j, key := range m.keys {
+		if j > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s: %s", Stringify(key), Stringify(m.entries[key]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// put assumes that the key has already been checked with isHashable
+func (m *Map) put(key Value, value Value) {
+	if _, ok := m.entries[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = value
+}
+
+func (m *Map) has(key Value) bool {
+	if !isHashable(key) {
+		return false
+	}
+	_, ok := m.entries[key]
+	return ok
+}
+
+func (m *Map) remove(key Value) Value {
+	if !m.has(key) {
+		return nil
+	}
+
+	value := m.entries[key]
+	delete(m.entries, key)
+	for j, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:j], m.keys[j+1:]...)
+			break
+		}
+	}
+	return value
+}
+
+func isTruthy(value Value) bool {
+	if value == nil {
+		return false
+	}
+	if bValue, ok := value.(bool); ok {
+		return bValue
+	}
+
+	return true
+}
+
+// Stringify formats a value the same way the tree-walking interpreter's
+// ToString does, so that both backends produce identical output
+func Stringify(value Value) string {
+	if value == nil {
+		return "nil"
+	}
+
+	if vFloat, ok := value.(float64); ok {
+		return strconv.FormatFloat(vFloat, 'f', -1, 64)
+	}
+
+	if named, ok := value.(fmt.Stringer); ok {
+		return named.String()
+	}
+
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,503 @@
+package vm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/faideww/glox/src/errors"
+	"github.com/faideww/glox/src/token"
+)
+
+const framesMax = 256
+const stackMax = framesMax * 256
+
+type callFrame struct {
+	closure *Closure
+	ip      int
+	slots   int
+}
+
+type VM struct {
+	frames       [framesMax]callFrame
+	frameCount   int
+	stack        [stackMax]Value
+	stackTop     int
+	globals      map[string]Value
+	openUpvalues *Upvalue
+}
+
+func NewVM() *VM {
+	vm := &VM{
+		globals: make(map[string]Value),
+	}
+
+	vm.DefineNative("clock", 0, func(args []Value) (Value, error) {
+		return float64(time.Now().Unix()), nil
+	})
+	vm.defineCollectionNatives()
+
+	return vm
+}
+
+func (vm *VM) DefineNative(name string, arity int, fn nativeFn) {
+	vm.globals[name] = NewNative(name, arity, fn)
+}
+
+// Interpret runs a compiled top-level function to completion, returning the
+// value it returns. Scripts compiled from statements return nil; scripts
+// compiled from a single expression return the value of that expression.
+func (vm *VM) Interpret(script *Function) (Value, error) {
+	vm.resetStack()
+	closure := &Closure{script, make([]*Upvalue, 0)}
+	vm.push(closure)
+	err := vm.call(closure, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := vm.run()
+	if err != nil {
+		vm.resetStack()
+		return nil, err
+	}
+	return result, nil
+}
+
+func (vm *VM) resetStack() {
+	vm.stackTop = 0
+	vm.frameCount = 0
+	vm.openUpvalues = nil
+}
+
+func (vm *VM) push(v Value) {
+	vm.stack[vm.stackTop] = v
+	vm.stackTop++
+}
+
+func (vm *VM) pop() Value {
+	vm.stackTop--
+	v := vm.stack[vm.stackTop]
+	vm.stack[vm.stackTop] = nil
+	return v
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[vm.stackTop-1-distance]
+}
+
+func (vm *VM) runtimeError(message string) error {
+	frame := &vm.frames[vm.frameCount-1]
+	pos := frame.closure.function.Chunk.Positions[frame.ip-1]
+	return errors.NewRuntimeError(token.Token{Position: pos}, message)
+}
+
+func (vm *VM) callValue(callee Value, argCount int) error {
+	switch callee := callee.(type) {
+	case *Closure:
+		return vm.call(callee, argCount)
+	case *BoundMethod:
+		vm.stack[vm.stackTop-argCount-1] = callee.receiver
+		return vm.call(callee.method, argCount)
+	case *Class:
+		instance := &Instance{callee, make(map[string]Value)}
+		vm.stack[vm.stackTop-argCount-1] = instance
+		if initializer, ok := callee.methods["init"]; ok {
+			return vm.call(initializer, argCount)
+		} else if argCount != 0 {
+			return vm.runtimeError(fmt.Sprintf("Expected 0 arguments but got %d", argCount))
+		}
+		return nil
+	case *Native:
+		if argCount != callee.arity {
+			return vm.runtimeError(fmt.Sprintf("Expected %d arguments but got %d", callee.arity, argCount))
+		}
+		args := make([]Value, argCount)
+		copy(args, vm.stack[vm.stackTop-argCount:vm.stackTop])
+		result, err := callee.fn(args)
+		if err != nil {
+			return vm.runtimeError(err.Error())
+		}
+		vm.stackTop -= argCount + 1
+		vm.push(result)
+		return nil
+	}
+	return vm.runtimeError("Can only call functions and classes")
+}
+
+func (vm *VM) call(closure *Closure, argCount int) error {
+	if argCount != closure.function.Arity {
+		return vm.runtimeError(fmt.Sprintf("Expected %d arguments but got %d", closure.function.Arity, argCount))
+	}
+
+	if vm.frameCount == framesMax {
+		return vm.runtimeError("Stack overflow")
+	}
+
+	vm.frames[vm.frameCount] = callFrame{
+		closure: closure,
+		ip:      0,
+		slots:   vm.stackTop - argCount - 1,
+	}
+	vm.frameCount++
+	return nil
+}
+
+func (vm *VM) bindMethod(class *Class, name string) (Value, bool) {
+	method, ok := class.methods[name]
+	if !ok {
+		return nil, false
+	}
+	return &BoundMethod{vm.peek(0), method}, true
+}
+
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	var prev *Upvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		prev = upvalue
+		upvalue = upvalue.next
+	}
+
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := &Upvalue{slot: slot, open: true, next: upvalue}
+	if prev == nil {
+		vm.openUpvalues = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+// closeUpvalues hoists every open upvalue at or above the given stack slot off
+// of the stack, so that closures can keep using them after the slot is popped
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.slot]
+		upvalue.open = false
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+func (vm *VM) getUpvalue(upvalue *Upvalue) Value {
+	if upvalue.open {
+		return vm.stack[upvalue.slot]
+	}
+	return upvalue.closed
+}
+
+func (vm *VM) setUpvalue(upvalue *Upvalue, value Value) {
+	if upvalue.open {
+		vm.stack[upvalue.slot] = value
+	} else {
+		upvalue.closed = value
+	}
+}
+
+func (vm *VM) run() (Value, error) {
+	frame := &vm.frames[vm.frameCount-1]
+	chunk := &frame.closure.function.Chunk
+
+	readByte := func() byte {
+		b := chunk.Code[frame.ip]
+		frame.ip++
+		return b
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return int(chunk.Code[frame.ip-2])<<8 | int(chunk.Code[frame.ip-1])
+	}
+	readConstant := func() Value {
+		return chunk.Constants[readByte()]
+	}
+	readString := func() string {
+		return readConstant().(string)
+	}
+	// refresh the cached frame after a call or return changes the frame stack
+	loadFrame := func() {
+		frame = &vm.frames[vm.frameCount-1]
+		chunk = &frame.closure.function.Chunk
+	}
+
+	for {
+		op := OpCode(readByte())
+		switch op {
+		case OP_CONSTANT:
+			vm.push(readConstant())
+		case OP_NIL:
+			vm.push(nil)
+		case OP_TRUE:
+			vm.push(true)
+		case OP_FALSE:
+			vm.push(false)
+		case OP_POP:
+			vm.pop()
+		case OP_GET_LOCAL:
+			vm.push(vm.stack[frame.slots+int(readByte())])
+		case OP_SET_LOCAL:
+			vm.stack[frame.slots+int(readByte())] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			name := readString()
+			value, ok := vm.globals[name]
+			if !ok {
+				return nil, vm.runtimeError(fmt.Sprintf("Undefined variable '%s'", name))
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL:
+			vm.globals[readString()] = vm.pop()
+		case OP_SET_GLOBAL:
+			name := readString()
+			if _, ok := vm.globals[name]; !ok {
+				return nil, vm.runtimeError(fmt.Sprintf("Undefined variable '%s'", name))
+			}
+			vm.globals[name] = vm.peek(0)
+		case OP_GET_UPVALUE:
+			vm.push(vm.getUpvalue(frame.closure.upvalues[readByte()]))
+		case OP_SET_UPVALUE:
+			vm.setUpvalue(frame.closure.upvalues[readByte()], vm.peek(0))
+		case OP_GET_PROPERTY:
+			name := readString()
+			instance, ok := vm.peek(0).(*Instance)
+			if !ok {
+				return nil, vm.runtimeError("Only instances can have properties")
+			}
+			if value, ok := instance.fields[name]; ok {
+				vm.pop()
+				vm.push(value)
+				break
+			}
+			method, ok := vm.bindMethod(instance.class, name)
+			if !ok {
+				return nil, vm.runtimeError(fmt.Sprintf("Undefined property '%s'", name))
+			}
+			vm.pop()
+			vm.push(method)
+		case OP_SET_PROPERTY:
+			name := readString()
+			instance, ok := vm.peek(1).(*Instance)
+			if !ok {
+				return nil, vm.runtimeError("Only instances have fields")
+			}
+			instance.fields[name] = vm.peek(0)
+			value := vm.pop()
+			vm.pop()
+			vm.push(value)
+		case OP_GET_SUPER:
+			name := readString()
+			superclass := vm.pop().(*Class)
+			method, ok := vm.bindMethod(superclass, name)
+			if !ok {
+				return nil, vm.runtimeError(fmt.Sprintf("Undefined property '%s'", name))
+			}
+			vm.pop()
+			vm.push(method)
+		case OP_EQUAL:
+			b, a := vm.pop(), vm.pop()
+			vm.push(a == b)
+		case OP_NOT_EQUAL:
+			b, a := vm.pop(), vm.pop()
+			vm.push(a != b)
+		case OP_GREATER, OP_GREATER_EQUAL, OP_LESS, OP_LESS_EQUAL, OP_SUBTRACT, OP_MULTIPLY, OP_DIVIDE:
+			b, bOk := vm.peek(0).(float64)
+			a, aOk := vm.peek(1).(float64)
+			if !aOk || !bOk {
+				return nil, vm.runtimeError("Operands must be numbers")
+			}
+			vm.pop()
+			vm.pop()
+			switch op {
+			case OP_GREATER:
+				vm.push(a > b)
+			case OP_GREATER_EQUAL:
+				vm.push(a >= b)
+			case OP_LESS:
+				vm.push(a < b)
+			case OP_LESS_EQUAL:
+				vm.push(a <= b)
+			case OP_SUBTRACT:
+				vm.push(a - b)
+			case OP_MULTIPLY:
+				vm.push(a * b)
+			case OP_DIVIDE:
+				if b == 0 {
+					return nil, vm.runtimeError("Divide by zero")
+				}
+				vm.push(a / b)
+			}
+		case OP_ADD:
+			bFloat, bOk := vm.peek(0).(float64)
+			aFloat, aOk := vm.peek(1).(float64)
+			if aOk && bOk {
+				vm.pop()
+				vm.pop()
+				vm.push(aFloat + bFloat)
+				break
+			}
+			_, aOk = vm.peek(1).(string)
+			_, bOk = vm.peek(0).(string)
+			if aOk || bOk {
+				b, a := vm.pop(), vm.pop()
+				vm.push(Stringify(a) + Stringify(b))
+				break
+			}
+			return nil, vm.runtimeError("Operands must be two numbers or two strings")
+		case OP_NOT:
+			vm.push(!isTruthy(vm.pop()))
+		case OP_NEGATE:
+			value, ok := vm.peek(0).(float64)
+			if !ok {
+				return nil, vm.runtimeError("Operand must be a number")
+			}
+			vm.pop()
+			vm.push(-value)
+		case OP_PRINT:
+			fmt.Println(Stringify(vm.pop()))
+		case OP_JUMP:
+			offset := readShort()
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if !isTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := readShort()
+			frame.ip -= offset
+		case OP_CALL:
+			argCount := int(readByte())
+			err := vm.callValue(vm.peek(argCount), argCount)
+			if err != nil {
+				return nil, err
+			}
+			loadFrame()
+		case OP_CLOSURE:
+			function := readConstant().(*Function)
+			closure := &Closure{function, make([]*Upvalue, function.UpvalueCount)}
+			for j := range closure.upvalues {
+				isLocal := readByte()
+				index := int(readByte())
+				if isLocal == 1 {
+					closure.upvalues[j] = vm.captureUpvalue(frame.slots + index)
+				} else {
+					closure.upvalues[j] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(vm.stackTop - 1)
+			vm.pop()
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.slots)
+			vm.frameCount--
+			if vm.frameCount == 0 {
+				vm.pop()
+				return result, nil
+			}
+			for vm.stackTop > frame.slots {
+				vm.pop()
+			}
+			vm.push(result)
+			loadFrame()
+		case OP_CLASS:
+			vm.push(&Class{readString(), make(map[string]*Closure)})
+		case OP_INHERIT:
+			superclass, ok := vm.peek(1).(*Class)
+			if !ok {
+				return nil, vm.runtimeError("Superclass must be a class")
+			}
+			subclass := vm.peek(0).(*Class)
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+			vm.pop()
+		case OP_METHOD:
+			name := readString()
+			method := vm.peek(0).(*Closure)
+			class := vm.peek(1).(*Class)
+			class.methods[name] = method
+			vm.pop()
+		case OP_BUILD_LIST:
+			count := int(readByte())
+			elements := make([]Value, count)
+			copy(elements, vm.stack[vm.stackTop-count:vm.stackTop])
+			vm.stackTop -= count
+			vm.push(&List{elements})
+		case OP_BUILD_MAP:
+			count := int(readByte())
+			m := NewMap()
+			for j := vm.stackTop - 2*count; j < vm.stackTop; j += 2 {
+				if !isHashable(vm.stack[j]) {
+					return nil, vm.runtimeError("Map keys must be strings, numbers or booleans")
+				}
+				m.put(vm.stack[j], vm.stack[j+1])
+			}
+			for j := 0; j < 2*count; j++ {
+				vm.pop()
+			}
+			vm.push(m)
+		case OP_GET_INDEX:
+			value, err := vm.getIndex(vm.peek(1), vm.peek(0))
+			if err != nil {
+				return nil, err
+			}
+			vm.pop()
+			vm.pop()
+			vm.push(value)
+		case OP_SET_INDEX:
+			err := vm.setIndex(vm.peek(2), vm.peek(1), vm.peek(0))
+			if err != nil {
+				return nil, err
+			}
+			value := vm.pop()
+			vm.pop()
+			vm.pop()
+			vm.push(value)
+		default:
+			return nil, vm.runtimeError(fmt.Sprintf("Unknown opcode %s", op))
+		}
+	}
+}
+
+func (vm *VM) getIndex(obj Value, index Value) (Value, error) {
+	switch obj := obj.(type) {
+	case *List:
+		j, message := obj.index(index)
+		if message != "" {
+			return nil, vm.runtimeError(message)
+		}
+		return obj.elements[j], nil
+	case *Map:
+		if !isHashable(index) {
+			return nil, vm.runtimeError("Map keys must be strings, numbers or booleans")
+		}
+		value, ok := obj.entries[index]
+		if !ok {
+			return nil, vm.runtimeError(fmt.Sprintf("Undefined key '%s'", Stringify(index)))
+		}
+		return value, nil
+	}
+	return nil, vm.runtimeError("Only lists and maps can be indexed")
+}
+
+func (vm *VM) setIndex(obj Value, index Value, value Value) error {
+	switch obj := obj.(type) {
+	case *List:
+		j, message := obj.index(index)
+		if message != "" {
+			return vm.runtimeError(message)
+		}
+		obj.elements[j] = value
+		return nil
+	case *Map:
+		if !isHashable(index) {
+			return vm.runtimeError("Map keys must be strings, numbers or booleans")
+		}
+		obj.put(index, value)
+		return nil
+	}
+	return vm.runtimeError("Only lists and maps can be indexed")
+}